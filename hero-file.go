@@ -3,9 +3,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/osallou/herodote-file/lib/keystone"
 	logs "github.com/osallou/herodote-file/lib/log"
@@ -34,6 +38,88 @@ func dirExists(name string) bool {
 	return false
 }
 
+func dirEmpty(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	return err == io.EOF
+}
+
+// parseTime parses a duration from now (1h, 30m), a RFC3339 date or a unix timestamp
+func parseTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s, expecting a duration (1h), a date (2006-01-02T15:04:05Z) or a timestamp", value)
+}
+
+// formatTimestamp formats a unix timestamp header value as a local date
+func formatTimestamp(value string) string {
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	return time.Unix(ts, 0).Format(time.RFC1123)
+}
+
+// uploadEntry is a file, directory or symlink to upload
+type uploadEntry struct {
+	path string
+	info os.FileInfo
+}
+
+// walkUpload returns entries to upload from path, a file or a directory, handling symlinks
+// according to symlinks policy
+func walkUpload(path string, filter swift.Filter, symlinks string) ([]uploadEntry, error) {
+	var entries []uploadEntry
+	err := swift.WalkLinks(path, filter, symlinks, os.Stdout, func(subPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Printf("failed to access path %q: %v\n", subPath, err)
+			return err
+		}
+		entries = append(entries, uploadEntry{path: subPath, info: info})
+		return nil
+	})
+	return entries, err
+}
+
+// uploadSizes returns sizes of files to upload
+func uploadSizes(entries []uploadEntry) []int64 {
+	var sizes []int64
+	for _, entry := range entries {
+		if entry.info.Mode().IsRegular() {
+			sizes = append(sizes, entry.info.Size())
+		}
+	}
+	return sizes
+}
+
+// remoteScheme prefixes remote paths of sync
+const remoteScheme = "swift:"
+
+// isRemotePath checks if a sync argument is a swift:<bucket>[/prefix] remote path
+func isRemotePath(value string) bool {
+	return strings.HasPrefix(value, remoteScheme)
+}
+
+// splitRemotePath splits a [swift:]bucket/prefix path
+func splitRemotePath(value string) (bucket string, prefix string) {
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(value, remoteScheme), "/"), "/", 2)
+	if len(parts) == 2 {
+		prefix = strings.TrimSuffix(parts[1], "/")
+	}
+	return parts[0], prefix
+}
+
 var Version string
 
 func main() {
@@ -44,22 +130,125 @@ func main() {
 	var delete = false
 	var list = false
 	var stat = false
+	var post = false
+	var create = false
+	var rmbucket = false
+	var capabilities = false
+	var policies = false
+	var versioning = false
+	var versions = false
+	var restore = false
+	var syncDir = false
+	var dryRun bool
+	var includes arrayFlags
+	var excludes arrayFlags
+	var excludeFrom string
+	var yes bool
+	var confirmAbove int
+	var deleteExtra bool
+	var quota = false
+	var quotaBytes int64
+	var quotaCount int64
+	var acl = false
+	var aclType string
+	var aclAccount bool
+	var action string
+	var versionID string
+	var versioningMode string
+	var versionsLocation string
+	var tempurl = false
+	var tempurlKey = false
+	var tempURLOptions = swift.TempURLOptions{}
+	var formpost = false
+	var formPostOptions = swift.FormPostOptions{}
+	var expires string
+	var deleteAfter string
+	var deleteAt string
+	var long bool
+	var copyObj = false
+	var moveObj = false
+	var destBucket string
+	var freshMetadata bool
+	var copyManifest bool
+	var createContainer bool
+	var recursive bool
+	var storagePolicy string
 	var file string
 	var bucket string
 	var objName string
 	var segmentSize int64
 	var prefix string
+	var match string
+	var regex string
 	var leaveSegments bool
+	var dirMarkers bool
+	var objectThreads int
+	var followSymlinks bool
+	var skipSymlinks bool
+	var storeSymlinks bool
+	var extractArchive bool
+	var archiveFormat string
 	var meta arrayFlags
+	var headers arrayFlags
+	var removeMeta arrayFlags
+	var contentType string
+	var contentEncoding string
+	var contentDisposition string
 	var ksAuth = keystone.KeystoneAuth{}
 	var helpVersion = false
 
 	flag.BoolVar(&helpVersion, "version", false, "Show version")
 	flag.BoolVar(&leaveSegments, "leaveSegments", false, "On file overwrite, do not delete old segment files")
-	flag.StringVar(&objName, "object-name", "", "Upload/download as")
+	flag.StringVar(&destBucket, "dest-bucket", "", "Destination bucket of copy/move, same bucket if not set")
+	flag.BoolVar(&freshMetadata, "fresh-metadata", false, "On copy, do not keep source metadata")
+	flag.BoolVar(&copyManifest, "copy-manifest", false, "On copy of large objects, copy manifest only, segments are shared")
+	flag.StringVar(&deleteAfter, "delete-after", "", "On upload/post, expire files after duration (24h)")
+	flag.StringVar(&deleteAt, "delete-at", "", "On upload/post, expire files at date (2006-01-02T15:04:05Z) or timestamp")
+	flag.BoolVar(&long, "long", false, "On list, show content type and expiration of files, or storage policy of buckets")
+	flag.StringVar(&tempURLOptions.Method, "method", "GET", "HTTP method allowed by temporary url")
+	flag.StringVar(&expires, "expires", "1h", "Temporary url expiration, duration (1h), date (2006-01-02T15:04:05Z) or timestamp")
+	flag.StringVar(&tempURLOptions.Key, "temp-url-key", "", "Temporary url key, bucket or account key is used if not set")
+	flag.StringVar(&tempURLOptions.Digest, "digest", "", "Signature digest: sha1, sha256 or sha512, default is sha256 for tempurl and sha1 for formpost")
+	flag.StringVar(&formPostOptions.Redirect, "redirect", "", "Formpost redirect url after upload")
+	flag.Int64Var(&formPostOptions.MaxFileSize, "max-file-size", 1000000000, "Formpost max size of each file")
+	flag.Int64Var(&formPostOptions.MaxFileCount, "max-file-count", 1, "Formpost max number of files")
+	flag.StringVar(&tempURLOptions.IPRange, "ip-range", "", "Restrict temporary url to an ip or network")
+	flag.StringVar(&versionID, "version-id", "", "On download/delete/restore, version of file to use")
+	flag.StringVar(&versioningMode, "versioning-mode", swift.VersioningNative, "Versioning mode to enable: native, stack or history")
+	flag.StringVar(&versionsLocation, "versions-location", "", "Bucket storing versions in stack and history modes, <bucket>_versions if not set")
+	flag.StringVar(&aclType, "acl-type", "", "ACL to manage: read (default) or write for buckets, admin, read-write or read-only for account")
+	flag.BoolVar(&aclAccount, "account", false, "On acl, manage account ACL instead of bucket ACL")
+	flag.Int64Var(&quotaBytes, "quota-bytes", -1, "On quota set, maximum bytes of bucket or account, 0 removes quota")
+	flag.Int64Var(&quotaCount, "quota-count", -1, "On quota set, maximum number of objects of bucket, 0 removes quota")
+	flag.Var(&includes, "include", "On directory upload, prefix operations and sync, only select files matching glob pattern (*.txt, data/**/*.csv), relative to directory or prefix, can be repeated")
+	flag.Var(&excludes, "exclude", "On directory upload, prefix operations and sync, skip files and directories matching glob pattern (.git, *.swp, /build), relative to directory or prefix, can be repeated")
+	flag.StringVar(&excludeFrom, "exclude-from", "", "Read exclude patterns from file, in gitignore syntax")
+	flag.BoolVar(&dryRun, "dry-run", false, "Show what upload, download, delete, sync, copy and move would do, without doing it")
+	flag.BoolVar(&yes, "yes", false, "Do not ask for confirmation before deleting many files")
+	flag.IntVar(&confirmAbove, "confirm-above", 100, "Ask for confirmation before deleting more files than this number, 0 never asks")
+	flag.BoolVar(&deleteExtra, "delete", false, "On sync, delete destination files missing from source")
+	flag.BoolVar(&createContainer, "create-container", false, "On upload, create bucket and its segments bucket if missing")
+	flag.BoolVar(&recursive, "recursive", false, "On rmbucket, delete bucket content first")
+	flag.StringVar(&storagePolicy, "storage-policy", "", "Storage policy of created buckets, segments buckets inherit policy of their bucket if not set")
+	flag.BoolVar(&extractArchive, "extract-archive", false, "On directory upload, send directory as a single archive extracted by the server")
+	flag.StringVar(&archiveFormat, "archive-format", "tar", "Archive format of extract-archive upload: tar or tar.gz, tar.bz2 is not supported")
+	flag.BoolVar(&dirMarkers, "dir-markers", false, "On directory upload, create directory marker objects for empty directories")
+	flag.IntVar(&objectThreads, "object-threads", 1, "Number of files processed concurrently on directory upload, prefix download and prefix delete")
+	flag.BoolVar(&followSymlinks, "follow-symlinks", false, "On directory upload and sync to bucket, upload content of symlinked directories, symlinked files are always uploaded by default")
+	flag.BoolVar(&skipSymlinks, "skip-symlinks", false, "On directory upload and sync to bucket, ignore symlinks")
+	flag.BoolVar(&storeSymlinks, "store-symlinks", false, "On directory upload, except extract-archive, store symlinks as symlink objects, on download restore symlink objects as symlinks")
+	flag.StringVar(&objName, "object-name", "", "Upload/download as, - to download to stdout")
+	flag.StringVar(&objName, "o", "", "Shortcut for object-name")
 	flag.StringVar(&prefix, "prefix", "", "File prefix for search/delete/download")
+	flag.StringVar(&match, "match", "", "On list, download, delete, copy and move, only select objects whose full name matches glob pattern (results/**/sample_*.vcf.gz)")
+	flag.StringVar(&regex, "regex", "", "On list, download, delete, copy and move, only select objects whose full name matches regular expression (^results/.*\\.vcf$)")
 	flag.Int64Var(&segmentSize, "segment-size", 1000000000, "Size of segments")
 	flag.Var(&meta, "meta", "upload meta data with format key:value.")
+	flag.Var(&removeMeta, "remove-meta", "meta data key to remove on post, can be repeated.")
+	flag.Var(&headers, "header", "upload request header with format \"Name: value\", can be repeated.")
+	flag.StringVar(&contentType, "content-type", "", "Content-Type of uploaded files, detected if not set")
+	flag.StringVar(&contentEncoding, "content-encoding", "", "Content-Encoding of uploaded files")
+	flag.StringVar(&contentDisposition, "content-disposition", "", "Content-Disposition of uploaded files")
 	/*
 			  --os-auth-url https://api.example.com/v3 \
 		      --os-project-name project1 --os-project-domain-name domain1 \
@@ -79,11 +268,29 @@ func main() {
 	cmdHelp := `
 Positional arguments:
 	<subcommand>
-		list		List content of a bucket
+		list		List content of a bucket, or account buckets if no bucket is given
 		stat		Show account/bucket/file metadata
-		upload		Upload a file or directory to a bucket
-		download	Download a file or list of files (prefix)
+		post		Update account/bucket/file metadata
+		create		Create a bucket
+		rmbucket	Delete a bucket
+		upload		Upload a file or directory to a bucket, - reads from stdin
+		download	Download a file or list of files (prefix), -o - writes to stdout
 		delete		Delete a file or a list of files (prefix)
+		sync		Upload new and changed files of a directory: sync <localdir> swift:<bucket>[/prefix],
+			or download new and changed files of a bucket: sync swift:<bucket>[/prefix] <localdir>
+			(exactly one argument must be a swift: remote path)
+		capabilities	Show cluster capabilities, or only the ones of a middleware
+		policies	List cluster storage policies
+		tempurl		Generate a temporary url to a file, or to all files with prefix
+		tempurl-key	Set bucket, or account if no bucket is given, temporary url key
+		formpost	Generate a signed html form to upload files in a bucket, with optional path prefix
+		versioning	Manage bucket versioning: versioning enable|disable|status <bucket>
+		versions	List versions of a file
+		quota		Manage bucket, or account if no bucket is given, quotas: quota set|show [bucket]
+		acl		Manage bucket or account ACL: acl get|set|add|remove <bucket> <elements>
+		restore		Restore a version of a file (version-id)
+		copy		Copy a file or a list of files (prefix), server side
+		move		Move a file or a list of files (prefix), server side
 
 Examples:
 
@@ -99,6 +306,46 @@ Examples:
   Upload a local file *localfile.txt* to a bucket with remote name *data/localfile.txt*
   hero-file --object-name data/localfile.txt upload mybucket localfile.txt
 
+  Upload stdin content to a bucket with remote name *backup.tar*
+  tar c dir | hero-file upload mybucket backup.tar -
+
+  Download bucket file *backup.tar* to stdout
+  hero-file download mybucket backup.tar -o - | tar x
+
+  Upload a local directory, keeping empty directories as directory markers
+  hero-file --dir-markers upload mybucket localdir
+
+  Upload a file with custom headers
+  hero-file --header "Cache-Control: max-age=3600" --header "X-Delete-After: 86400" upload mybucket localfile.txt
+
+  Upload a directory without git and editor files, nor files ignored by git:
+  hero-file --exclude .git --exclude "*.swp" --exclude-from localdir/.gitignore upload mybucket localdir
+
+  Download csv files of prefix *data/*:
+  hero-file --prefix data/ --include "**/*.csv" download mybucket
+
+  Download compressed vcf files of any sub directory of *results/*, only *results/* is sent as prefix to server:
+  hero-file --match "results/**/sample_*.vcf.gz" download mybucket
+
+  List files whose name ends with a date:
+  hero-file --regex "_[0-9]{8}$" list mybucket
+
+  Upload a directory of many files, 8 files at a time:
+  hero-file --object-threads 8 upload mybucket localdir
+
+  Upload a directory keeping its symlinks, and restore them on download:
+  hero-file --store-symlinks upload mybucket localdir
+  hero-file --store-symlinks --prefix localdir download mybucket
+
+  Upload a directory with many small files as a single compressed archive, under *data/*
+  hero-file --extract-archive --archive-format tar.gz --object-name data upload mybucket localdir
+
+  Synchronize a local directory under *backup/* prefix, removing remote files deleted locally:
+  hero-file --delete sync localdir swift:mybucket/backup
+
+  Mirror files of *mybucket* with prefix *backup/* in a local directory:
+  hero-file --delete sync swift:mybucket/backup localdir
+
   Delete a remote file:
   hero-file delete mybucket data/myfile.txt
 
@@ -108,11 +355,81 @@ Examples:
   Delete all files:
   hero-file --prefix "**/*" delete mybucket
 
+  Show files which would be deleted, without deleting them:
+  hero-file --dry-run --prefix data delete mybucket
+
+  Copy a remote file to another bucket with a new name:
+  hero-file --dest-bucket otherbucket --object-name data/copy.txt copy mybucket data/myfile.txt
+
+  Rename all files with prefix *data/* to prefix *archive/*:
+  hero-file --prefix data/ --object-name archive/ move mybucket
+
+  Show cluster static large object capabilities:
+  hero-file capabilities slo
+
+  Share a file for one day:
+  hero-file --expires 24h tempurl mybucket data/myfile.txt
+
+  Allow upload of files with prefix *incoming/* for one hour:
+  hero-file --method PUT --prefix incoming/ tempurl mybucket
+
+  Generate a form allowing upload of 5 files under *incoming/* for one day:
+  hero-file --expires 24h --max-file-count 5 --redirect https://portal.example.com/done formpost mybucket incoming/
+
+  Set bucket temporary url key:
+  hero-file --temp-url-key mysecret tempurl-key mybucket
+
+  Enable versioning on a bucket, and list versions of a file:
+  hero-file versioning enable mybucket
+  hero-file versions mybucket data/myfile.txt
+
+  Download, restore or delete a version of a file:
+  hero-file --version-id 1500000000.00000 download mybucket data/myfile.txt
+  hero-file --version-id 1500000000.00000 restore mybucket data/myfile.txt
+  hero-file --version-id 1500000000.00000 delete mybucket data/myfile.txt
+
+  Limit a bucket to 10GB and 1000 files:
+  hero-file --quota-bytes 10000000000 --quota-count 1000 quota set mybucket
+
+  Give read access on a bucket to a user of another project, and make bucket listable from any referrer:
+  hero-file acl add mybucket project2:user1,.r:*,.rlistings
+
+  Remove write access of a user on a bucket:
+  hero-file --acl-type write acl remove mybucket project2:user1
+
+  Give admin access on account to a user:
+  hero-file --account --acl-type admin acl add project2:user1
+
+  Show all account ACL:
+  hero-file --account acl get
+
   Get bucket information:
   hero-file stat mybucket
 
   Get file information:
   hero-file stat mybucket data/myfile.txt
+
+  Update file metadata, removing *old* key:
+  hero-file --meta project:test --remove-meta old post mybucket data/myfile.txt
+
+  Create a bucket with a storage policy:
+  hero-file --storage-policy gold create mybucket
+
+  List storage policies, and buckets with their policy:
+  hero-file policies
+  hero-file --long list
+
+  Delete a bucket and all its content:
+  hero-file --recursive rmbucket mybucket
+
+  Upload a file expiring in one week:
+  hero-file --delete-after 168h upload mybucket results.tar
+
+  Change expiration of a file:
+  hero-file --delete-at 2030-01-01T00:00:00Z post mybucket results.tar
+
+  Make bucket public:
+  hero-file --header "X-Container-Read: .r:*,.rlistings" post mybucket
 	`
 	flag.Usage = func() {
 		fmt.Fprintf(CommandLine.Output(), "Usage of %s:\n", os.Args[0])
@@ -136,16 +453,57 @@ Examples:
 	switch tail[0] {
 	case "stat":
 		stat = true
+	case "post":
+		post = true
+	case "create":
+		create = true
+	case "rmbucket":
+		rmbucket = true
+	case "capabilities":
+		capabilities = true
+	case "policies":
+		policies = true
+	case "tempurl":
+		tempurl = true
+	case "tempurl-key":
+		tempurlKey = true
+	case "formpost":
+		formpost = true
+	case "versioning":
+		versioning = true
+	case "versions":
+		versions = true
+	case "acl":
+		acl = true
+	case "quota":
+		quota = true
+	case "restore":
+		restore = true
+	case "copy":
+		copyObj = true
+	case "move":
+		moveObj = true
 	case "upload":
 		upload = true
 	case "download":
 		download = true
 	case "delete":
 		delete = true
+	case "sync":
+		syncDir = true
 	case "list":
 		list = true
 	}
 
+	if versioning || acl || quota {
+		// <subcommand> <action> <bucket> <file>
+		if lenTail > 1 {
+			action = tail[1]
+			tail = tail[1:]
+			lenTail--
+		}
+	}
+
 	if lenTail > 1 {
 		bucket = tail[1]
 	}
@@ -154,10 +512,16 @@ Examples:
 		file = tail[2]
 	}
 
-	if lenTail > 4 && tail[3] == "--object-name" {
+	if lenTail > 4 && (tail[3] == "--object-name" || tail[3] == "-o") {
 		objName = tail[4]
 	}
 
+	if upload && lenTail > 3 && tail[3] == "-" {
+		// upload <bucket> <object> - : read object content from stdin
+		objName = tail[2]
+		file = "-"
+	}
+
 	if helpVersion {
 		fmt.Printf("Version: %s\n", Version)
 		return
@@ -210,12 +574,87 @@ Examples:
 
 	metaData := make(map[string]string)
 	for m := range meta {
-		kv := strings.Split(meta[m], ":")
-		if len(kv) != 2 {
-			continue
+		k, v, err := swift.ParseHeader(meta[m])
+		if err != nil {
+			fmt.Printf("Invalid meta: %s\n", err)
+			return
+		}
+		metaData[k] = v
+		fmt.Printf("Meta %s: %s\n", k, v)
+	}
+
+	headerData := make(map[string]string)
+	for h := range headers {
+		k, v, err := swift.ParseHeader(headers[h])
+		if err != nil {
+			fmt.Printf("Invalid header: %s\n", err)
+			return
 		}
-		metaData[kv[0]] = kv[1]
-		fmt.Printf("Meta %s: %s\n", kv[0], kv[1])
+		headerData[k] = v
+	}
+
+	filter := swift.Filter{Include: includes, Exclude: excludes}
+	if excludeFrom != "" {
+		rules, err := swift.ReadIgnoreFile(excludeFrom)
+		if err != nil {
+			fmt.Printf("Invalid exclude-from: %s\n", err)
+			return
+		}
+		filter.Ignore = rules
+	}
+	if err := filter.Validate(); err != nil {
+		fmt.Printf("Invalid filter: %s\n", err)
+		return
+	}
+	if match != "" {
+		if err := swift.ValidateGlob(match); err != nil {
+			fmt.Printf("Invalid match: %s\n", err)
+			return
+		}
+	}
+	var matchRegex *regexp.Regexp
+	if regex != "" {
+		var err error
+		if matchRegex, err = regexp.Compile(regex); err != nil {
+			fmt.Printf("Invalid regex: %s\n", err)
+			return
+		}
+	}
+	symlinks := ""
+	nbSymlinkModes := 0
+	for mode, set := range map[string]bool{swift.SymlinksFollow: followSymlinks, swift.SymlinksSkip: skipSymlinks, swift.SymlinksStore: storeSymlinks} {
+		if set {
+			symlinks = mode
+			nbSymlinkModes++
+		}
+	}
+	if nbSymlinkModes > 1 {
+		fmt.Printf("follow-symlinks, skip-symlinks and store-symlinks are exclusive\n")
+		return
+	}
+	// match patterns select objects like a prefix does
+	prefixOp := prefix != "" || match != "" || regex != ""
+	if segmentSize <= 0 {
+		fmt.Printf("Invalid segment-size: %d, must be positive\n", segmentSize)
+		return
+	}
+
+	var expiration int64
+	if deleteAfter != "" {
+		d, err := time.ParseDuration(deleteAfter)
+		if err != nil {
+			fmt.Printf("Invalid delete-after: %s\n", err)
+			return
+		}
+		expiration = time.Now().Add(d).Unix()
+	}
+	if deleteAt != "" {
+		t, err := parseTime(deleteAt)
+		if err != nil {
+			fmt.Printf("Invalid delete-at: %s\n", err)
+			return
+		}
+		expiration = t.Unix()
 	}
 
 	var options = swift.Options{
@@ -225,7 +664,31 @@ Examples:
 		Size:          segmentSize,
 		Prefix:        prefix,
 		LeaveSegments: leaveSegments,
-		Meta:          metaData}
+		Meta:          metaData,
+
+		ContentType:        contentType,
+		ContentEncoding:    contentEncoding,
+		ContentDisposition: contentDisposition,
+		Headers:            headerData,
+		RemoveMeta:         removeMeta,
+		StoragePolicy:      storagePolicy,
+		Recursive:          recursive,
+		DestBucket:         destBucket,
+		FreshMetadata:      freshMetadata,
+		CopyManifest:       copyManifest,
+		ArchiveFormat:      archiveFormat,
+		DeleteAt:           expiration,
+		VersionID:          versionID,
+		DeleteExtra:        deleteExtra,
+		DryRun:             dryRun,
+		Filter:             filter,
+		Match:              match,
+		Regex:              matchRegex,
+		Symlinks:           symlinks,
+		ObjectThreads:      objectThreads}
+	if !yes {
+		options.ConfirmAbove = confirmAbove
+	}
 
 	if upload {
 		if bucket == "" {
@@ -237,55 +700,458 @@ Examples:
 			fmt.Printf("file option is missing")
 			return
 		}
-		if dirExists(options.File) {
-			// this is a directory upload
-			// Loop over files
-			err := filepath.Walk(options.File, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					fmt.Printf("failed to access path %q: %v\n", path, err)
-					return err
-				}
-				if info.IsDir() {
-					fmt.Printf("Look in dir: %+v \n", info.Name())
-					return nil
-				}
+		if err := swift.CheckUpload(token, server, options); err != nil {
+			fmt.Printf("Upload refused: %s\n", err)
+			return
+		}
+		if createContainer {
+			if err := swift.EnsureContainers(token, server, swift.Options{Bucket: bucket, StoragePolicy: storagePolicy, DryRun: dryRun}); err != nil {
+				fmt.Printf("An error occured: %s\n", err)
+				return
+			}
+		}
+		var entries []uploadEntry
+		if file != "-" {
+			var err error
+			entries, err = walkUpload(options.File, filter, options.Symlinks)
+			if err != nil {
+				fmt.Printf("An error occured: %s\n", err)
+				return
+			}
+			sizes := uploadSizes(entries)
+			quotaOptions := options
+			if extractArchive {
+				// extracted files are not segmented
+				quotaOptions.Size = 0
+			}
+			if err := swift.CheckQuota(token, server, quotaOptions, sizes); err != nil {
+				fmt.Printf("Upload refused: %s\n", err)
+				return
+			}
+		}
+		if extractArchive {
+			if !dirExists(options.File) {
+				fmt.Printf("extract-archive requires a directory\n")
+				return
+			}
+			result, err := swift.UploadArchive(token, server, options)
+			for _, name := range result.Created {
+				fmt.Printf("Created %s\n", name)
+			}
+			for name, reason := range result.Errors {
+				fmt.Printf("Failed %s: %s\n", name, reason)
+			}
+			if err != nil {
+				fmt.Printf("An error occured: %s\n", err)
+				return
+			}
+			if !dryRun {
+				fmt.Printf("Uploaded %d files, %d failures\n", len(result.Created), len(result.Errors))
+			}
+		} else if dirExists(options.File) {
+			// this is a directory upload, objects are uploaded by objectThreads workers
+			var tasks []swift.ObjectTask
+			for _, entry := range entries {
+				path := entry.path
+				info := entry.info
 				subObjectName := path
 				if options.ObjectName != "" {
 					old := options.File
 					new := strings.TrimPrefix(options.ObjectName, "/")
 					subObjectName = strings.Replace(path, old, new, -1)
 				}
-				var subOptions = swift.Options{Bucket: bucket, File: path, ObjectName: subObjectName, Size: segmentSize, Prefix: prefix, LeaveSegments: leaveSegments, Meta: metaData}
-				swift.Upload(token, server, subOptions)
-				return nil
-			})
-			if err != nil {
-				fmt.Printf("Got an error: %v", err)
+				if info.IsDir() {
+					// directories are not objects, only their markers are
+					fmt.Printf("Look in dir: %+v \n", info.Name())
+					if dirMarkers && dirEmpty(path) {
+						tasks = append(tasks, func(out io.Writer) error {
+							var markerOptions = swift.Options{Bucket: bucket, File: path, ObjectName: subObjectName, Meta: metaData, DryRun: dryRun, Output: out}
+							if !swift.UploadDirMarker(token, server, markerOptions) {
+								return fmt.Errorf("failed to create directory marker %s", subObjectName)
+							}
+							return nil
+						})
+					}
+					continue
+				}
+				tasks = append(tasks, func(out io.Writer) error {
+					var subOptions = options
+					subOptions.File = path
+					subOptions.ObjectName = subObjectName
+					subOptions.Output = out
+					if info.Mode()&os.ModeSymlink != 0 {
+						if !swift.UploadSymlink(token, server, subOptions) {
+							return fmt.Errorf("failed to upload symlink %s", path)
+						}
+						return nil
+					}
+					if !swift.Upload(token, server, subOptions) {
+						return fmt.Errorf("failed to upload %s", path)
+					}
+					return nil
+				})
+			}
+			if err := swift.RunObjects(objectThreads, tasks); err != nil {
+				fmt.Printf("An error occured: %s\n", err)
 				return
 			}
 
 		} else {
 			swift.Upload(token, server, options)
 		}
+	} else if syncDir {
+		// sync <localdir> swift:<bucket>[/prefix] or sync swift:<bucket>[/prefix] <localdir>
+		if bucket == "" || file == "" {
+			fmt.Printf("Source or destination is missing\n")
+			return
+		}
+		// direction is never guessed, a wrong guess with --delete removes files
+		if isRemotePath(bucket) == isRemotePath(file) {
+			fmt.Printf("Ambiguous sync direction, exactly one of source and destination must be a %s<bucket>[/prefix] remote path\n", remoteScheme)
+			return
+		}
+		syncOptions := options
+		syncOptions.ObjectName = ""
+		var result swift.SyncResult
+		var err error
+		if isRemotePath(file) {
+			if !dirExists(bucket) {
+				fmt.Printf("Local directory %s does not exist\n", bucket)
+				return
+			}
+			syncOptions.File = bucket
+			syncOptions.Bucket, syncOptions.Prefix = splitRemotePath(file)
+			if createContainer {
+				if err := swift.EnsureContainers(token, server, swift.Options{Bucket: syncOptions.Bucket, StoragePolicy: storagePolicy, DryRun: dryRun}); err != nil {
+					fmt.Printf("An error occured: %s\n", err)
+					return
+				}
+			}
+			result, err = swift.SyncToRemote(token, server, syncOptions)
+		} else {
+			syncOptions.File = file
+			syncOptions.Bucket, syncOptions.Prefix = splitRemotePath(bucket)
+			result, err = swift.SyncFromRemote(token, server, syncOptions)
+		}
+		for name, reason := range result.Errors {
+			fmt.Printf("Failed %s: %s\n", name, reason)
+		}
+		if dryRun {
+			fmt.Printf("Dry run, nothing done: %s\n", result)
+		} else {
+			fmt.Printf("%s\n", result)
+		}
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
 	} else if download {
 		if bucket == "" {
 			fmt.Printf("Bucket is missing\n")
 			return
 		}
-		if prefix != "" {
-			swift.DownloadWithPrefix(token, server, options)
+		if prefixOp {
+			if err := swift.DownloadWithPrefix(token, server, options); err != nil {
+				fmt.Printf("An error occured: %s\n", err)
+				return
+			}
+		} else if versionID != "" {
+			swift.DownloadVersion(token, server, options)
 		} else {
 			swift.Download(token, server, options)
 		}
 	} else if delete {
-		if prefix != "" {
-			swift.DeleteWithPrefix(token, server, options)
+		var err error
+		if prefixOp {
+			err = swift.DeleteWithPrefix(token, server, options)
 		} else {
 			if file == "" {
 				fmt.Printf("file option is missing")
 				return
 			}
-			swift.DeleteWithSegments(token, server, options)
+			if versionID != "" {
+				err = swift.DeleteVersion(token, server, options)
+			} else {
+				err = swift.DeleteWithSegments(token, server, options)
+			}
+		}
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+	} else if capabilities {
+		info, err := swift.Capabilities(token, server)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		var sections []string
+		for section := range info {
+			if bucket == "" || section == bucket {
+				sections = append(sections, section)
+			}
+		}
+		sort.Strings(sections)
+		for _, section := range sections {
+			fmt.Printf("%s:\n", section)
+			var keys []string
+			for k := range info[section] {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Printf("\t%s: %v\n", k, info[section][k])
+			}
+		}
+	} else if policies {
+		clusterPolicies, err := swift.StoragePolicies(token, server)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		for _, policy := range clusterPolicies {
+			line := policy.Name
+			if policy.Aliases != "" {
+				line = fmt.Sprintf("%s, aliases: %s", line, policy.Aliases)
+			}
+			if policy.Default {
+				line = line + ", default"
+			}
+			fmt.Printf("%s\n", line)
+		}
+	} else if tempurl {
+		if bucket == "" {
+			fmt.Printf("Bucket is missing\n")
+			return
+		}
+		if file == "" && prefix == "" {
+			fmt.Printf("file or prefix option is missing\n")
+			return
+		}
+		tempURLOptions.Prefix = file == ""
+		expiresAt, err := parseTime(expires)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		tempURLOptions.Expires = expiresAt
+		url, err := swift.TempURL(token, server, options, tempURLOptions)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		fmt.Printf("%s\n", url)
+	} else if formpost {
+		if bucket == "" {
+			fmt.Printf("Bucket is missing\n")
+			return
+		}
+		if file != "" {
+			options.Prefix = file
+		}
+		expiresAt, err := parseTime(expires)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		formPostOptions.Expires = expiresAt
+		formPostOptions.Key = tempURLOptions.Key
+		formPostOptions.Digest = tempURLOptions.Digest
+		form, err := swift.GenerateFormPost(token, server, options, formPostOptions)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		fmt.Printf("Action: %s\n", form.Action)
+		for _, field := range form.Fields {
+			fmt.Printf("%s: %s\n", field.Name, field.Value)
+		}
+		fmt.Printf("\n%s\n", form.HTML())
+	} else if tempurlKey {
+		if tempURLOptions.Key == "" {
+			fmt.Printf("temp-url-key option is missing\n")
+			return
+		}
+		if err := swift.SetTempURLKey(token, server, options, tempURLOptions.Key); err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		fmt.Printf("Temporary url key updated\n")
+	} else if versioning {
+		if bucket == "" {
+			fmt.Printf("Bucket is missing\n")
+			return
+		}
+		var err error
+		switch action {
+		case "enable":
+			err = swift.SetVersioning(token, server, options, swift.Versioning{Mode: versioningMode, Location: versionsLocation})
+		case "disable":
+			err = swift.SetVersioning(token, server, options, swift.Versioning{})
+		case "status":
+		default:
+			fmt.Printf("Unknown versioning action %s, expecting enable, disable or status\n", action)
+			return
+		}
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		v, err := swift.GetVersioning(token, server, bucket)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		if v.Mode == "" {
+			fmt.Printf("Versioning: disabled\n")
+		} else if v.Location != "" {
+			fmt.Printf("Versioning: %s, versions location: %s\n", v.Mode, v.Location)
+		} else {
+			fmt.Printf("Versioning: %s\n", v.Mode)
+		}
+	} else if quota {
+		switch action {
+		case "set":
+			if err := swift.SetQuota(token, server, options, quotaBytes, quotaCount); err != nil {
+				fmt.Printf("An error occured: %s\n", err)
+				return
+			}
+		case "show":
+		default:
+			fmt.Printf("Unknown quota action %s, expecting set or show\n", action)
+			return
+		}
+		q, err := swift.GetQuota(token, server, options)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		if q.QuotaBytes < 0 {
+			fmt.Printf("Bytes: %d, no quota\n", q.Bytes)
+		} else {
+			fmt.Printf("Bytes: %d / %d, remaining: %d\n", q.Bytes, q.QuotaBytes, q.RemainingBytes())
+		}
+		if q.QuotaCount < 0 {
+			fmt.Printf("Objects: %d, no quota\n", q.Count)
+		} else {
+			fmt.Printf("Objects: %d / %d, remaining: %d\n", q.Count, q.QuotaCount, q.RemainingCount())
+		}
+	} else if acl && aclAccount {
+		// acl <action> <elements>, no bucket, get shows all levels
+		if aclType == "" && action != "get" {
+			fmt.Printf("acl-type option is missing\n")
+			return
+		}
+		accountACL, err := swift.GetAccountACL(token, server)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		if action != "get" {
+			accountACL[aclType], err = swift.EditACL(accountACL[aclType], action, swift.ParseACL(bucket), true)
+			if err != nil {
+				fmt.Printf("An error occured: %s\n", err)
+				return
+			}
+			if err := swift.SetAccountACL(token, server, accountACL); err != nil {
+				fmt.Printf("An error occured: %s\n", err)
+				return
+			}
+		}
+		var levels []string
+		for level := range accountACL {
+			levels = append(levels, level)
+		}
+		sort.Strings(levels)
+		if len(levels) == 0 {
+			fmt.Printf("No account ACL\n")
+		}
+		for _, level := range levels {
+			fmt.Printf("%s: %s\n", level, swift.FormatACL(accountACL[level]))
+		}
+	} else if acl {
+		if bucket == "" {
+			fmt.Printf("Bucket is missing\n")
+			return
+		}
+		if aclType != "" && aclType != "read" && aclType != "write" {
+			fmt.Printf("Invalid acl-type %s, expecting read or write\n", aclType)
+			return
+		}
+		containerACL, err := swift.GetContainerACL(token, server, options)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		if action != "get" {
+			if aclType == "write" {
+				containerACL.Write, err = swift.EditACL(containerACL.Write, action, swift.ParseACL(file), true)
+			} else {
+				containerACL.Read, err = swift.EditACL(containerACL.Read, action, swift.ParseACL(file), false)
+			}
+			if err != nil {
+				fmt.Printf("An error occured: %s\n", err)
+				return
+			}
+			if err := swift.SetContainerACL(token, server, options, containerACL); err != nil {
+				fmt.Printf("An error occured: %s\n", err)
+				return
+			}
+		}
+		fmt.Printf("Read ACL: %s\n", swift.FormatACL(containerACL.Read))
+		fmt.Printf("Write ACL: %s\n", swift.FormatACL(containerACL.Write))
+	} else if versions {
+		if bucket == "" || file == "" {
+			fmt.Printf("Bucket or file is missing\n")
+			return
+		}
+		objVersions, err := swift.ListVersions(token, server, options)
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		for _, v := range objVersions {
+			latest := ""
+			if v.IsLatest {
+				latest = ", latest"
+			}
+			fmt.Printf("%s, size: %d, last: %s%s\n", v.ID, v.Bytes, v.LastModified, latest)
+		}
+	} else if restore {
+		if bucket == "" || file == "" || versionID == "" {
+			fmt.Printf("Bucket, file or version-id is missing\n")
+			return
+		}
+		if err := swift.RestoreVersion(token, server, options); err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+	} else if copyObj || moveObj {
+		if bucket == "" {
+			fmt.Printf("Bucket is missing\n")
+			return
+		}
+		var err error
+		if prefixOp {
+			if moveObj {
+				err = swift.MoveWithPrefix(token, server, options)
+			} else {
+				err = swift.CopyWithPrefix(token, server, options)
+			}
+		} else {
+			if file == "" {
+				fmt.Printf("file option is missing")
+				return
+			}
+			if moveObj {
+				err = swift.Move(token, server, options)
+			} else {
+				err = swift.Copy(token, server, options)
+			}
+		}
+		if err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
 		}
 	} else if stat {
 		statInfo, err := swift.Show(token, server, options)
@@ -315,16 +1181,82 @@ Examples:
 				fmt.Printf("Container bytes count: %s\n", v)
 			case "X-Container-Meta-Quota-Bytes":
 				fmt.Printf("Container quota bytes: %s\n", v)
+			case "X-Container-Meta-Quota-Count":
+				fmt.Printf("Container quota count: %s\n", v)
+			case "X-Container-Read":
+				fmt.Printf("Container read ACL: %s\n", v)
+			case "X-Container-Write":
+				fmt.Printf("Container write ACL: %s\n", v)
+			case "X-Storage-Policy":
+				fmt.Printf("Storage policy: %s\n", v)
 			case "Etag":
 				fmt.Printf("MD5 => %s\n", v)
+			case "X-Delete-At":
+				fmt.Printf("Expires => %s\n", formatTimestamp(v))
+			}
+		}
+	} else if post {
+		if err := swift.Post(token, server, options); err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+		fmt.Printf("Metadata updated\n")
+	} else if create {
+		if bucket == "" {
+			fmt.Printf("Bucket is missing\n")
+			return
+		}
+		if err := swift.CreateContainer(token, server, options); err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+	} else if rmbucket {
+		if bucket == "" {
+			fmt.Printf("Bucket is missing\n")
+			return
+		}
+		if prefixOp || len(includes) > 0 || len(excludes) > 0 || excludeFrom != "" {
+			// whole bucket is deleted, a selection would only delete some objects and orphan segments
+			fmt.Printf("prefix, match, regex and filters cannot be used with rmbucket\n")
+			return
+		}
+		if err := swift.DeleteContainer(token, server, options); err != nil {
+			fmt.Printf("An error occured: %s\n", err)
+			return
+		}
+	} else if list && bucket == "" {
+		containers := swift.ListContainers(token, server, options)
+		var totalCount, totalBytes uint64
+		for _, container := range containers {
+			if long {
+				policy := "unknown"
+				if info, err := swift.Show(token, server, swift.Options{Bucket: container.Name}); err == nil && info["X-Storage-Policy"] != "" {
+					policy = info["X-Storage-Policy"]
+				}
+				fmt.Printf("%s, count: %d, size: %d, last: %s, policy: %s\n", container.Name, container.Count, container.Bytes, container.LastModified, policy)
+			} else {
+				fmt.Printf("%s, count: %d, size: %d, last: %s\n", container.Name, container.Count, container.Bytes, container.LastModified)
 			}
+			totalCount += container.Count
+			totalBytes += container.Bytes
 		}
+		fmt.Printf("Total: %d buckets, count: %d, size: %d\n", len(containers), totalCount, totalBytes)
 	} else if list {
 		options.File = ""
 		options.ObjectName = ""
-		files := swift.List(token, server, options)
+		files := swift.ListMatching(token, server, options)
 		for _, file := range files {
-			fmt.Printf("%s, size: %d, last: %s\n", file.Name, file.Bytes, file.LastModified)
+			if !long {
+				fmt.Printf("%s, size: %d, last: %s\n", file.Name, file.Bytes, file.LastModified)
+				continue
+			}
+			expiresAt := "never"
+			fileOptions := options
+			fileOptions.File = file.Name
+			if info, err := swift.Show(token, server, fileOptions); err == nil && info["X-Delete-At"] != "" {
+				expiresAt = formatTimestamp(info["X-Delete-At"])
+			}
+			fmt.Printf("%s, size: %d, last: %s, type: %s, expires: %s\n", file.Name, file.Bytes, file.LastModified, file.ContentType, expiresAt)
 		}
 	} else {
 		fmt.Printf("No operation selected\n")
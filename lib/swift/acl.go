@@ -0,0 +1,214 @@
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ContainerACL describes container read and write ACLs
+type ContainerACL struct {
+	Read  []string
+	Write []string
+}
+
+// AccountACL maps account access levels (admin, read-write, read-only) to users
+type AccountACL map[string][]string
+
+// accountACLLevels are the valid keys of X-Account-Access-Control
+var accountACLLevels = []string{"admin", "read-write", "read-only"}
+
+// ParseACL splits a container ACL string in its elements
+func ParseACL(acl string) []string {
+	var elements []string
+	for _, e := range strings.Split(acl, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			elements = append(elements, e)
+		}
+	}
+	return elements
+}
+
+// FormatACL joins ACL elements in a container ACL string
+func FormatACL(elements []string) string {
+	return strings.Join(elements, ",")
+}
+
+// ValidateACLElement checks an element of container read (write=false) or write ACL
+//
+// Valid elements are project:user (with * wildcards), .r:referrer, .r:-referrer and .rlistings,
+// referrer elements are only allowed in read ACLs.
+func ValidateACLElement(element string, write bool) error {
+	if element == "" || strings.ContainsAny(element, ", \t\n") {
+		return fmt.Errorf("invalid ACL element %q", element)
+	}
+	if element == ".rlistings" || strings.HasPrefix(element, ".r:") || strings.HasPrefix(element, ".referrer:") {
+		if write {
+			return fmt.Errorf("referrer element %s not allowed in write ACL", element)
+		}
+		if element != ".rlistings" {
+			referrer := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(element, ".r:"), ".referrer:"), "-")
+			if referrer == "" {
+				return fmt.Errorf("missing referrer in %s", element)
+			}
+		}
+		return nil
+	}
+	if strings.HasPrefix(element, ".") {
+		return fmt.Errorf("unknown ACL directive %s", element)
+	}
+	if parts := strings.Split(element, ":"); len(parts) > 2 || parts[0] == "" || (len(parts) == 2 && parts[1] == "") {
+		return fmt.Errorf("invalid ACL element %s, expecting project:user", element)
+	}
+	return nil
+}
+
+// AddACL adds elements to an ACL element list, ignoring existing ones
+func AddACL(acl []string, elements []string, write bool) ([]string, error) {
+	result := append([]string{}, acl...)
+	for _, e := range elements {
+		if err := ValidateACLElement(e, write); err != nil {
+			return acl, err
+		}
+		found := false
+		for _, existing := range result {
+			if existing == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// RemoveACL removes elements from an ACL element list
+func RemoveACL(acl []string, elements []string) []string {
+	var result []string
+	for _, existing := range acl {
+		removed := false
+		for _, e := range elements {
+			if existing == e {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
+
+// EditACL applies action set, add or remove of elements to an ACL element list
+func EditACL(acl []string, action string, elements []string, write bool) ([]string, error) {
+	switch action {
+	case "set":
+		return AddACL(nil, elements, write)
+	case "add":
+		return AddACL(acl, elements, write)
+	case "remove":
+		return RemoveACL(acl, elements), nil
+	}
+	return acl, fmt.Errorf("unknown ACL action %s, expecting set, add or remove", action)
+}
+
+// GetContainerACL gets ACLs of container options.Bucket
+func GetContainerACL(token string, server string, options Options) (ContainerACL, error) {
+	info, err := Show(token, server, Options{Bucket: options.Bucket})
+	if err != nil {
+		return ContainerACL{}, err
+	}
+	return ContainerACL{
+		Read:  ParseACL(info["X-Container-Read"]),
+		Write: ParseACL(info["X-Container-Write"]),
+	}, nil
+}
+
+// SetContainerACL sets ACLs of container options.Bucket, empty ACLs are removed
+func SetContainerACL(token string, server string, options Options, acl ContainerACL) error {
+	for _, e := range acl.Read {
+		if err := ValidateACLElement(e, false); err != nil {
+			return err
+		}
+	}
+	for _, e := range acl.Write {
+		if err := ValidateACLElement(e, true); err != nil {
+			return err
+		}
+	}
+	headers := make(map[string]string)
+	if len(acl.Read) > 0 {
+		headers["X-Container-Read"] = FormatACL(acl.Read)
+	} else {
+		headers["X-Remove-Container-Read"] = "x"
+	}
+	if len(acl.Write) > 0 {
+		headers["X-Container-Write"] = FormatACL(acl.Write)
+	} else {
+		headers["X-Remove-Container-Write"] = "x"
+	}
+	return postHeaders(token, server, options.Bucket, "", headers)
+}
+
+// GetAccountACL gets account ACLs from X-Account-Access-Control, only available to account owners
+func GetAccountACL(token string, server string) (AccountACL, error) {
+	acl := make(AccountACL)
+	info, err := Show(token, server, Options{})
+	if err != nil {
+		return acl, err
+	}
+	value := info["X-Account-Access-Control"]
+	if value == "" {
+		return acl, nil
+	}
+	if err := json.Unmarshal([]byte(value), &acl); err != nil {
+		return acl, fmt.Errorf("failed to decode account ACL: %s", err)
+	}
+	return acl, nil
+}
+
+// ValidateAccountACL checks account ACL levels
+func ValidateAccountACL(acl AccountACL) error {
+	for level := range acl {
+		valid := false
+		for _, l := range accountACLLevels {
+			if level == l {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid account ACL level %s, expecting one of %s", level, strings.Join(accountACLLevels, ", "))
+		}
+	}
+	return nil
+}
+
+// SetAccountACL sets X-Account-Access-Control, removes it if acl has no users
+func SetAccountACL(token string, server string, acl AccountACL) error {
+	if err := ValidateAccountACL(acl); err != nil {
+		return err
+	}
+	for level, users := range acl {
+		if len(users) == 0 {
+			delete(acl, level)
+			continue
+		}
+		sort.Strings(users)
+	}
+	headers := make(map[string]string)
+	if len(acl) == 0 {
+		headers["X-Remove-Account-Access-Control"] = "x"
+	} else {
+		value, err := json.Marshal(acl)
+		if err != nil {
+			return err
+		}
+		headers["X-Account-Access-Control"] = string(value)
+	}
+	return postHeaders(token, server, "", "", headers)
+}
@@ -0,0 +1,83 @@
+package swift_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftEditACL(t *testing.T) {
+	acl := swift.ParseACL(" project1:user1, .r:*,,.rlistings ")
+	if swift.FormatACL(acl) != "project1:user1,.r:*,.rlistings" {
+		t.Errorf("wrong parsed ACL: %v", acl)
+	}
+	acl, err := swift.EditACL(acl, "add", []string{"project2:*", "project1:user1"}, false)
+	if err != nil || swift.FormatACL(acl) != "project1:user1,.r:*,.rlistings,project2:*" {
+		t.Errorf("wrong ACL after add: %v, %v", acl, err)
+	}
+	acl, _ = swift.EditACL(acl, "remove", []string{".r:*", ".rlistings"}, false)
+	if swift.FormatACL(acl) != "project1:user1,project2:*" {
+		t.Errorf("wrong ACL after remove: %v", acl)
+	}
+	for _, element := range []string{".r:", "project:", ":user", "a:b:c", ".unknown", "a b"} {
+		if _, err := swift.EditACL(nil, "set", []string{element}, false); err == nil {
+			t.Errorf("invalid element %q accepted", element)
+		}
+	}
+	if _, err := swift.EditACL(nil, "add", []string{".r:*"}, true); err == nil {
+		t.Errorf("referrer accepted in write ACL")
+	}
+}
+
+func TestSwiftSetACL(t *testing.T) {
+	var containerHeaders, accountHeaders http.Header
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "HEAD":
+			res.Header().Set("X-Container-Read", "project1:user1")
+			res.Header().Set("X-Account-Access-Control", `{"read-only":["project1:user1"]}`)
+			res.WriteHeader(204)
+		case "POST":
+			if req.URL.Path == "/project/" {
+				containerHeaders = req.Header
+			} else {
+				accountHeaders = req.Header
+			}
+			res.WriteHeader(204)
+		default:
+			res.WriteHeader(404)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "project"}
+	containerACL, err := swift.GetContainerACL("123", testServer.URL, options)
+	if err != nil || len(containerACL.Read) != 1 || len(containerACL.Write) != 0 {
+		t.Fatalf("wrong container ACL: %+v, %v", containerACL, err)
+	}
+	containerACL.Write = []string{"project2:user2"}
+	if err := swift.SetContainerACL("123", testServer.URL, options, containerACL); err != nil {
+		t.Fatalf("failed to set container ACL: %s", err)
+	}
+	if containerHeaders.Get("X-Container-Read") != "project1:user1" || containerHeaders.Get("X-Container-Write") != "project2:user2" {
+		t.Errorf("wrong container ACL headers: %v", containerHeaders)
+	}
+
+	accountACL, err := swift.GetAccountACL("123", testServer.URL)
+	if err != nil || len(accountACL["read-only"]) != 1 {
+		t.Fatalf("wrong account ACL: %+v, %v", accountACL, err)
+	}
+	accountACL["read-only"] = nil
+	if err := swift.SetAccountACL("123", testServer.URL, accountACL); err != nil {
+		t.Fatalf("failed to set account ACL: %s", err)
+	}
+	if accountHeaders.Get("X-Remove-Account-Access-Control") == "" {
+		t.Errorf("account ACL not removed: %v", accountHeaders)
+	}
+	accountACL["owner"] = []string{"project1:user1"}
+	if err := swift.SetAccountACL("123", testServer.URL, accountACL); err == nil {
+		t.Errorf("invalid account ACL level accepted")
+	}
+}
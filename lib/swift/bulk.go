@@ -0,0 +1,437 @@
+package swift
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// default number of objects per bulk delete request if not advertised by cluster
+const defaultBulkDeleteSize = 1000
+
+// number of concurrent requests when bulk delete is not available
+const deleteWorkers = 10
+
+// BulkDeleteResult reports a bulk delete operation
+type BulkDeleteResult struct {
+	Deleted  int
+	NotFound int
+	// Errors maps object path to failure reason
+	Errors map[string]string
+}
+
+type bulkDeleteResponse struct {
+	NumberDeleted  int        `json:"Number Deleted"`
+	NumberNotFound int        `json:"Number Not Found"`
+	ResponseStatus string     `json:"Response Status"`
+	ResponseBody   string     `json:"Response Body"`
+	Errors         [][]string `json:"Errors"`
+}
+
+// errBulkNotSupported is returned when cluster does not support bulk delete requests
+var errBulkNotSupported = errors.New("bulk delete not supported")
+
+// objectPath returns the /container/object path of an object, url encoded
+func objectPath(bucket string, object string) string {
+	return (&neturl.URL{Path: "/" + bucket + "/" + object}).EscapedPath()
+}
+
+// bulkDeleteRequest deletes a batch of object paths with a single bulk-delete request
+func bulkDeleteRequest(token string, server string, paths []string, result *BulkDeleteResult) error {
+	client := &http.Client{}
+	url := server + "?bulk-delete"
+	logger.Debugf("Call %s with %d objects\n", url, len(paths))
+	req, _ := http.NewRequest("POST", url, bytes.NewReader([]byte(strings.Join(paths, "\n"))))
+	req.Header.Add("X-Auth-Token", token)
+	req.Header.Add("Content-Type", "text/plain")
+	req.Header.Add("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorf("Failed to contact server %s\n", server)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 400 || resp.StatusCode == 404 || resp.StatusCode == 405 || resp.StatusCode == 501 {
+		return errBulkNotSupported
+	}
+	if resp.StatusCode != 200 {
+		logger.Errorf("Error: %s\n", resp.Status)
+		return errors.New(resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var answer bulkDeleteResponse
+	if err := json.Unmarshal(body, &answer); err != nil {
+		logger.Errorf("Failed to decode answer\n")
+		return err
+	}
+	result.Deleted += answer.NumberDeleted
+	result.NotFound += answer.NumberNotFound
+	for _, e := range answer.Errors {
+		if len(e) == 2 {
+			result.Errors[e[0]] = e[1]
+		}
+	}
+	if len(answer.Errors) == 0 && !strings.HasPrefix(answer.ResponseStatus, "200") {
+		// whole batch failed
+		for _, p := range paths {
+			result.Errors[p] = answer.ResponseStatus
+		}
+	}
+	return nil
+}
+
+// deletePath deletes a single object from its /container/object path
+func deletePath(token string, server string, path string) (int, error) {
+	client := &http.Client{}
+	logger.Debugf("Call %s%s\n", server, path)
+	req, _ := http.NewRequest("DELETE", server+path, nil)
+	req.Header.Add("X-Auth-Token", token)
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorf("Failed to contact server %s\n", server)
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// concurrentDelete deletes objects one by one with workers concurrent requests
+func concurrentDelete(token string, server string, paths []string, workers int, result *BulkDeleteResult) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	ch := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range ch {
+				status, err := deletePath(token, server, path)
+				lock.Lock()
+				switch {
+				case err != nil:
+					result.Errors[path] = err.Error()
+				case status == 204:
+					result.Deleted++
+				case status == 404:
+					result.NotFound++
+				default:
+					result.Errors[path] = http.StatusText(status)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, path := range paths {
+		ch <- path
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// BulkDelete deletes a list of /container/object paths
+//
+// Objects are deleted with bulk-delete requests in batches of the cluster limit,
+// or with concurrent individual requests if bulk delete is not available.
+func BulkDelete(token string, server string, paths []string) BulkDeleteResult {
+	return bulkDelete(token, server, paths, deleteWorkers)
+}
+
+// bulkDelete deletes paths as BulkDelete, with workers concurrent requests if bulk delete is not available
+func bulkDelete(token string, server string, paths []string, workers int) BulkDeleteResult {
+	result := BulkDeleteResult{Errors: make(map[string]string)}
+	if len(paths) == 0 {
+		return result
+	}
+	batchSize := int64(0)
+	if info, err := Capabilities(token, server); err == nil && info.Has("bulk_delete") {
+		batchSize = defaultBulkDeleteSize
+		if maxDeletes, ok := info.Int("bulk_delete", "max_deletes_per_request"); ok && maxDeletes > 0 {
+			batchSize = maxDeletes
+		}
+	}
+	if batchSize == 0 {
+		logger.Debugf("Bulk delete not available, delete objects one by one")
+		concurrentDelete(token, server, paths, workers, &result)
+		return result
+	}
+	for start := int64(0); start < int64(len(paths)); start += batchSize {
+		end := start + batchSize
+		if end > int64(len(paths)) {
+			end = int64(len(paths))
+		}
+		err := bulkDeleteRequest(token, server, paths[start:end], &result)
+		if err == errBulkNotSupported {
+			logger.Debugf("Bulk delete rejected, delete objects one by one")
+			concurrentDelete(token, server, paths[start:], workers, &result)
+			return result
+		}
+		if err != nil {
+			for _, p := range paths[start:end] {
+				result.Errors[p] = err.Error()
+			}
+		}
+	}
+	return result
+}
+
+// objectPaths lists paths to delete for an object, including its segments
+// if it is a manifest and options.LeaveSegments is not set, and their total size
+func objectPaths(token string, server string, options Options, file SwiftFile) ([]string, int64) {
+	var paths []string
+	size := int64(file.Bytes)
+	// manifests have no content, no need to check other objects
+	if !options.LeaveSegments && file.Bytes == 0 {
+		options.File = file.Name
+		options.ObjectName = file.Name
+		manifest := Head(token, server, options)
+		if manifest != "" {
+			segOptions := options
+			segOptions.Bucket, segOptions.Prefix = manifestLocation(manifest)
+			if segOptions.Prefix != "" {
+				for _, segment := range List(token, server, segOptions) {
+					paths = append(paths, objectPath(segOptions.Bucket, segment.Name))
+					size += int64(segment.Bytes)
+				}
+			}
+		}
+	}
+	return append(paths, objectPath(options.Bucket, file.Name)), size
+}
+
+// confirm asks a question on stdin, only y or yes answers are a confirmation
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// deleteObjects deletes paths, of size bytes, of a number of listed objects and of their segments,
+// and prints result
+//
+// With options.DryRun, paths are only printed. Confirmation is asked if there are more
+// than options.ConfirmAbove listed objects, segments are not counted.
+func deleteObjects(token string, server string, options Options, objects int, paths []string, size int64) (BulkDeleteResult, error) {
+	result := BulkDeleteResult{Errors: make(map[string]string)}
+	if options.DryRun {
+		for _, path := range paths {
+			fmt.Printf("Would delete %s\n", path)
+		}
+		fmt.Printf("Would delete %d objects, %d bytes\n", len(paths), size)
+		return result, nil
+	}
+	if options.ConfirmAbove > 0 && objects > options.ConfirmAbove {
+		if !confirm(fmt.Sprintf("Delete %d objects, %d bytes?", objects, size)) {
+			return result, errors.New("deletion cancelled")
+		}
+	}
+	workers := deleteWorkers
+	if options.ObjectThreads > 1 {
+		workers = options.ObjectThreads
+	}
+	result = bulkDelete(token, server, paths, workers)
+	return result, printBulkDeleteResult(output(options), result)
+}
+
+// printBulkDeleteResult prints deletion summary and returns an error if some objects failed
+func printBulkDeleteResult(out io.Writer, result BulkDeleteResult) error {
+	for path, reason := range result.Errors {
+		fmt.Fprintf(out, "Failed to delete %s: %s\n", path, reason)
+	}
+	fmt.Fprintf(out, "Deleted %d objects, %d not found, %d failures\n", result.Deleted, result.NotFound, len(result.Errors))
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("failed to delete %d objects", len(result.Errors))
+	}
+	return nil
+}
+
+// ExtractArchiveResult reports an extract-archive upload
+type ExtractArchiveResult struct {
+	// Created lists uploaded object names
+	Created []string
+	// Errors maps object path to failure reason
+	Errors map[string]string
+}
+
+type extractArchiveResponse struct {
+	NumberFilesCreated int        `json:"Number Files Created"`
+	ResponseStatus     string     `json:"Response Status"`
+	ResponseBody       string     `json:"Response Body"`
+	Errors             [][]string `json:"Errors"`
+}
+
+// writeArchive writes regular files of dir selected by filter as a tar archive, optionally gzip compressed,
+// and returns archived names, skipped symlinks are reported to out
+func writeArchive(w io.Writer, dir string, filter Filter, symlinks string, out io.Writer, compress bool) ([]string, error) {
+	var names []string
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	err := WalkLinks(dir, filter, symlinks, out, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(tw, f); err != nil {
+			return err
+		}
+		logger.Debugf("Archived %s", hdr.Name)
+		names = append(names, hdr.Name)
+		return nil
+	})
+	if err != nil {
+		return names, err
+	}
+	if err := tw.Close(); err != nil {
+		return names, err
+	}
+	if gz != nil {
+		return names, gz.Close()
+	}
+	return names, nil
+}
+
+// UploadArchive uploads directory options.File to options.Bucket with a single extract-archive request
+//
+// A tar archive (gzip compressed if options.ArchiveFormat is "tar.gz") is built on the fly and
+// streamed to the cluster, which extracts it. Objects are prefixed by options.ObjectName if set.
+func UploadArchive(token string, server string, options Options) (ExtractArchiveResult, error) {
+	result := ExtractArchiveResult{Errors: make(map[string]string)}
+	format := options.ArchiveFormat
+	switch format {
+	case "", "tar":
+		format = "tar"
+	case "gz", "tar.gz":
+		format = "tar.gz"
+	case "bz2", "tar.bz2":
+		// standard library has no bzip2 writer
+		return result, errors.New("bzip2 compression is not supported, use tar or tar.gz")
+	default:
+		return result, fmt.Errorf("unknown archive format %s", options.ArchiveFormat)
+	}
+	if options.Symlinks == SymlinksStore {
+		// extract-archive only creates regular objects
+		return result, errors.New("symlinks cannot be stored with extract-archive, follow or skip them")
+	}
+
+	if options.DryRun {
+		var count, size int64
+		err := WalkLinks(options.File, options.Filter, options.Symlinks, output(options), func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				count++
+				size += info.Size()
+			}
+			return err
+		})
+		fmt.Printf("Would upload archive of %d files, %d bytes: %s => %s/%s\n", count, size, options.File, options.Bucket, strings.Trim(options.ObjectName, "/"))
+		return result, err
+	}
+
+	pr, pw := io.Pipe()
+	var names []string
+	done := make(chan bool)
+	go func() {
+		var err error
+		names, err = writeArchive(pw, options.File, options.Filter, options.Symlinks, output(options), format == "tar.gz")
+		pw.CloseWithError(err)
+		close(done)
+	}()
+
+	client := &http.Client{}
+	url := []string{server, options.Bucket}
+	if options.ObjectName != "" {
+		url = append(url, strings.Trim(options.ObjectName, "/"))
+	}
+	reqURL := strings.Join(url, "/") + "?extract-archive=" + format
+	fmt.Printf("Upload archive: %s => %s\n", options.File, strings.Join(url[1:], "/"))
+	logger.Debugf("Call %s\n", reqURL)
+	req, _ := http.NewRequest("PUT", reqURL, pr)
+	req.ContentLength = -1
+	req.Header.Add("X-Auth-Token", token)
+	req.Header.Add("Accept", "application/json")
+	for m := range options.Meta {
+		req.Header.Add("X-Object-Meta-"+m, options.Meta[m])
+	}
+	for h := range options.Headers {
+		req.Header.Set(h, options.Headers[h])
+	}
+	resp, err := client.Do(req)
+	// stop archive creation if server stopped reading
+	pr.Close()
+	<-done
+	if err != nil {
+		logger.Errorf("Failed to contact server %s\n", server)
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		logger.Errorf("Error: %s\n", resp.Status)
+		return result, errors.New(resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return result, err
+	}
+	var answer extractArchiveResponse
+	if err := json.Unmarshal(body, &answer); err != nil {
+		logger.Errorf("Failed to decode answer\n")
+		return result, err
+	}
+	failed := make(map[string]bool)
+	for _, e := range answer.Errors {
+		if len(e) == 2 {
+			result.Errors[e[0]] = e[1]
+			failed[e[0]] = true
+		}
+	}
+	if !strings.HasPrefix(answer.ResponseStatus, "201") && len(answer.Errors) == 0 {
+		return result, fmt.Errorf("archive extraction failed: %s %s", answer.ResponseStatus, answer.ResponseBody)
+	}
+	prefix := strings.Join(url[1:], "/")
+	for _, name := range names {
+		if !failed["/"+prefix+"/"+name] {
+			result.Created = append(result.Created, name)
+		}
+	}
+	if len(result.Created) != answer.NumberFilesCreated {
+		logger.Debugf("Cluster reports %d files created out of %d", answer.NumberFilesCreated, len(names))
+	}
+	return result, nil
+}
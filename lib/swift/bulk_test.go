@@ -0,0 +1,225 @@
+package swift_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftBulkDelete(t *testing.T) {
+	var batches []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/info" {
+			res.WriteHeader(200)
+			res.Write([]byte(`{"swift": {"version": "2.20.0"}, "bulk_delete": {"max_deletes_per_request": 2}}`))
+			return
+		}
+		if req.Method == "POST" && req.URL.RawQuery == "bulk-delete" {
+			body, _ := ioutil.ReadAll(req.Body)
+			batches = append(batches, string(body))
+			res.WriteHeader(200)
+			if strings.Contains(string(body), "locked") {
+				res.Write([]byte(`{"Number Deleted": 1, "Number Not Found": 0, "Response Status": "400 Bad Request", "Errors": [["/project/locked", "409 Conflict"]]}`))
+				return
+			}
+			res.Write([]byte(`{"Number Deleted": 2, "Number Not Found": 0, "Response Status": "200 OK", "Errors": []}`))
+			return
+		}
+		res.WriteHeader(405)
+	}))
+	defer func() { testServer.Close() }()
+
+	paths := []string{"/project/a", "/project/b", "/project/c", "/project/locked"}
+	result := swift.BulkDelete("123", testServer.URL+"/v1/AUTH_test", paths)
+	if len(batches) != 2 {
+		t.Errorf("expected 2 batches, got %d", len(batches))
+	}
+	if result.Deleted != 3 {
+		t.Errorf("expected 3 deleted objects, got %d", result.Deleted)
+	}
+	if result.Errors["/project/locked"] != "409 Conflict" {
+		t.Errorf("failure not reported: %v", result.Errors)
+	}
+}
+
+func TestSwiftBulkDeleteFallback(t *testing.T) {
+	deleted := make(chan string, 10)
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == "DELETE" {
+			deleted <- req.URL.Path
+			if strings.HasSuffix(req.URL.Path, "missing") {
+				res.WriteHeader(404)
+				return
+			}
+			res.WriteHeader(204)
+			return
+		}
+		res.WriteHeader(404)
+	}))
+	defer func() { testServer.Close() }()
+
+	paths := []string{"/project/a", "/project/b", "/project/missing"}
+	result := swift.BulkDelete("123", testServer.URL+"/v1/AUTH_test", paths)
+	if len(deleted) != 3 {
+		t.Errorf("expected 3 delete requests, got %d", len(deleted))
+	}
+	if result.Deleted != 2 || result.NotFound != 1 || len(result.Errors) != 0 {
+		t.Errorf("wrong result: %+v", result)
+	}
+}
+
+func TestSwiftUploadArchive(t *testing.T) {
+	var members []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "PUT" || req.URL.Query().Get("extract-archive") != "tar.gz" {
+			res.WriteHeader(405)
+			return
+		}
+		gz, _ := gzip.NewReader(req.Body)
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			members = append(members, hdr.Name)
+		}
+		res.WriteHeader(201)
+		res.Write([]byte(`{"Number Files Created": 1, "Response Status": "400 Bad Request", "Errors": [["/project/data/sub/b.txt", "413 Request Entity Too Large"]]}`))
+	}))
+	defer func() { testServer.Close() }()
+
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("b"), 0644)
+
+	options := swift.Options{Bucket: "project", File: dir, ObjectName: "data", ArchiveFormat: "tar.gz"}
+	result, err := swift.UploadArchive("123", testServer.URL, options)
+	if err != nil {
+		t.Fatalf("archive upload failed: %s", err)
+	}
+	if len(members) != 2 {
+		t.Errorf("expected 2 archive members, got %v", members)
+	}
+	if len(result.Created) != 1 || result.Created[0] != "a.txt" {
+		t.Errorf("wrong created files: %v", result.Created)
+	}
+	if _, ok := result.Errors["/project/data/sub/b.txt"]; !ok {
+		t.Errorf("failure not reported: %v", result.Errors)
+	}
+
+	options.ArchiveFormat = "tar.bz2"
+	if _, err := swift.UploadArchive("123", testServer.URL, options); err == nil {
+		t.Error("bzip2 should not be supported")
+	}
+}
+
+func TestSwiftDryRun(t *testing.T) {
+	var mutations []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			res.WriteHeader(200)
+			if req.URL.Query().Get("marker") != "" {
+				res.Write([]byte(`[]`))
+				return
+			}
+			res.Write([]byte(`[{"name": "data/a", "bytes": 1}, {"name": "data/b", "bytes": 2}]`))
+		case "HEAD":
+			res.Header().Set("Content-Length", "1")
+			res.WriteHeader(200)
+		default:
+			mutations = append(mutations, req.Method+" "+req.URL.Path)
+			res.WriteHeader(204)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "local.txt")
+	ioutil.WriteFile(localFile, []byte("0123456789"), 0644)
+
+	options := swift.Options{Bucket: "project", File: localFile, ObjectName: "local.txt", Size: 4, DryRun: true}
+	if !swift.Upload("123", testServer.URL, options) {
+		t.Error("dry run upload failed")
+	}
+	options = swift.Options{Bucket: "project", Prefix: "data/", DryRun: true}
+	if err := swift.DeleteWithPrefix("123", testServer.URL, options); err != nil {
+		t.Errorf("dry run delete failed: %s", err)
+	}
+	options = swift.Options{Bucket: "project", File: "data/a", DestBucket: "other", DryRun: true}
+	if err := swift.Move("123", testServer.URL, options); err != nil {
+		t.Errorf("dry run move failed: %s", err)
+	}
+	options = swift.Options{Bucket: "project", File: dir, Prefix: "data", Size: 100, DeleteExtra: true, DryRun: true}
+	result, err := swift.SyncToRemote("123", testServer.URL, options)
+	if err != nil || len(result.Transferred) != 1 || len(result.Deleted) != 2 {
+		t.Errorf("wrong dry run sync: %+v, %v", result, err)
+	}
+	if len(mutations) > 0 {
+		t.Errorf("dry run modified content: %v", mutations)
+	}
+}
+
+func TestSwiftDeleteConfirmation(t *testing.T) {
+	deletes := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			res.WriteHeader(200)
+			if req.URL.Query().Get("marker") != "" {
+				res.Write([]byte(`[]`))
+				return
+			}
+			res.Write([]byte(`[{"name": "data/a", "bytes": 1}, {"name": "data/b", "bytes": 2}]`))
+		case "DELETE":
+			deletes++
+			res.WriteHeader(204)
+		case "HEAD":
+			if req.URL.Path == "/project/large" {
+				res.Header().Set("X-Object-Manifest", "project_segments/data/")
+			}
+			res.WriteHeader(200)
+		default:
+			res.WriteHeader(404)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	r, w, _ := os.Pipe()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	w.Write([]byte("n\n"))
+	w.Close()
+
+	options := swift.Options{Bucket: "project", Prefix: "data/", ConfirmAbove: 1}
+	if err := swift.DeleteWithPrefix("123", testServer.URL, options); err == nil {
+		t.Error("refused deletion should fail")
+	}
+	if deletes != 0 {
+		t.Errorf("objects deleted without confirmation: %d", deletes)
+	}
+	options.ConfirmAbove = 2
+	if err := swift.DeleteWithPrefix("123", testServer.URL, options); err != nil || deletes != 2 {
+		t.Errorf("deletion below threshold failed: %v, %d deletes", err, deletes)
+	}
+
+	// segments are not counted, a single object is deleted without confirmation
+	deletes = 0
+	options = swift.Options{Bucket: "project", File: "large", ConfirmAbove: 1}
+	if err := swift.DeleteWithSegments("123", testServer.URL, options); err != nil || deletes != 3 {
+		t.Errorf("deletion of object with segments failed: %v, %d deletes", err, deletes)
+	}
+}
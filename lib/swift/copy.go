@@ -0,0 +1,223 @@
+package swift
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// copyObject copies an object server side with a COPY request
+//
+// query is added to source url (multipart-manifest=get to copy a manifest itself)
+func copyObject(token string, server string, srcBucket string, srcObject string, destBucket string, destObject string, query string, headers map[string]string) error {
+	client := &http.Client{}
+	url := []string{server, srcBucket, srcObject}
+	reqURL := strings.Join(url, "/")
+	if query != "" {
+		reqURL = reqURL + "?" + query
+	}
+	destination := (&neturl.URL{Path: "/" + destBucket + "/" + destObject}).EscapedPath()
+	logger.Debugf("Call COPY %s => %s\n", reqURL, destination)
+	req, _ := http.NewRequest("COPY", reqURL, nil)
+	req.Header.Add("X-Auth-Token", token)
+	req.Header.Add("Destination", destination)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorf("Failed to contact server %s\n", server)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 201 {
+		logger.Errorf("Failed to copy %s/%s: %s", srcBucket, srcObject, resp.Status)
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// copyDestination returns destination bucket and object name of a copy
+func copyDestination(options Options) (string, string) {
+	destBucket := options.DestBucket
+	if destBucket == "" {
+		destBucket = options.Bucket
+	}
+	destObject := options.ObjectName
+	if destObject == "" {
+		destObject = options.File
+	}
+	return destBucket, strings.TrimPrefix(destObject, "/")
+}
+
+// copyHeaders returns request headers setting meta data of copied object
+func copyHeaders(options Options) map[string]string {
+	headers := make(map[string]string)
+	if options.FreshMetadata {
+		headers["X-Fresh-Metadata"] = "true"
+	}
+	if options.ContentType != "" {
+		headers["Content-Type"] = options.ContentType
+	}
+	for m := range options.Meta {
+		headers["X-Object-Meta-"+m] = options.Meta[m]
+	}
+	for h := range options.Headers {
+		headers[h] = options.Headers[h]
+	}
+	return headers
+}
+
+// copySegmentedObject copies segments of a dynamic large object in destination
+// bucket segments container and creates a new manifest referencing them
+func copySegmentedObject(token string, server string, manifest string, srcMeta map[string]string, options Options) error {
+	destBucket, destObject := copyDestination(options)
+	container, prefix := manifestLocation(manifest)
+	segments := List(token, server, Options{Bucket: container, Prefix: prefix})
+	total := uint64(0)
+	for _, segment := range segments {
+		total += segment.Bytes
+	}
+	ts := strconv.FormatInt(time.Now().UnixNano(), 10)
+	size := strconv.FormatUint(total, 10)
+	segmentPrefix := []string{destBucket + "_segments", destObject, ts, size}
+	for i, segment := range segments {
+		index := fmt.Sprintf("%010d", i)
+		segmentName := strings.Join([]string{destObject, ts, size, index}, "/")
+		logger.Debugf("Copy segment %s/%s => %s", container, segment.Name, segmentName)
+		if err := copyObject(token, server, container, segment.Name, destBucket+"_segments", segmentName, "", nil); err != nil {
+			return fmt.Errorf("failed to copy segment %s: %s", segment.Name, err)
+		}
+	}
+
+	manifestOptions := options
+	manifestOptions.Bucket = destBucket
+	manifestOptions.ObjectName = destObject
+	manifestOptions.Meta = make(map[string]string)
+	if !options.FreshMetadata {
+		for k, v := range srcMeta {
+			if strings.HasPrefix(k, "X-Object-Meta-") {
+				manifestOptions.Meta[strings.TrimPrefix(k, "X-Object-Meta-")] = v
+			}
+		}
+		if manifestOptions.ContentType == "" {
+			manifestOptions.ContentType = srcMeta["Content-Type"]
+		}
+	}
+	for m := range options.Meta {
+		manifestOptions.Meta[m] = options.Meta[m]
+	}
+	if !uploadManifest(token, server, strings.Join(segmentPrefix, "/"), manifestOptions) {
+		return fmt.Errorf("failed to create manifest %s/%s", destBucket, destObject)
+	}
+	return nil
+}
+
+// Copy copies object options.File to options.DestBucket (same bucket if empty) as options.ObjectName, server side
+//
+// Source meta data are kept unless options.FreshMetadata is set, options.Meta are added.
+// Segments of a dynamic large object are copied too and a new manifest is created, unless
+// options.CopyManifest is set, in which case only the manifest is copied and segments are shared.
+// Static large object manifests are copied with options.CopyManifest, else data is copied by the server.
+func Copy(token string, server string, options Options) error {
+	destBucket, destObject := copyDestination(options)
+	if destBucket == options.Bucket && destObject == options.File {
+		return fmt.Errorf("source and destination are the same: %s/%s", destBucket, destObject)
+	}
+	srcMeta, err := Show(token, server, options)
+	if err != nil {
+		return err
+	}
+	manifest := srcMeta["X-Object-Manifest"]
+	slo := strings.ToLower(srcMeta["X-Static-Large-Object"]) == "true"
+	if options.DryRun {
+		fmt.Printf("Would copy %s/%s => %s/%s, %s bytes\n", options.Bucket, options.File, destBucket, destObject, srcMeta["Content-Length"])
+		if manifest != "" && !options.CopyManifest {
+			fmt.Printf("Would copy segments %s\n", manifest)
+		}
+		return nil
+	}
+	fmt.Printf("Copy %s/%s => %s/%s\n", options.Bucket, options.File, destBucket, destObject)
+	if manifest != "" && !options.CopyManifest {
+		return copySegmentedObject(token, server, manifest, srcMeta, options)
+	}
+	query := ""
+	if (manifest != "" || slo) && options.CopyManifest {
+		query = "multipart-manifest=get"
+	}
+	headers := copyHeaders(options)
+	if manifest != "" {
+		// keep manifest header, else a fresh metadata copy would lose it
+		headers["X-Object-Manifest"] = manifest
+	}
+	return copyObject(token, server, options.Bucket, options.File, destBucket, destObject, query, headers)
+}
+
+// Move moves object options.File to options.DestBucket as options.ObjectName, server side
+//
+// In the same bucket, large objects are moved by copying their manifest only, segments are kept.
+// To another bucket, segments of dynamic large objects are copied in destination bucket segments
+// container and deleted with source object, so that they do not stay in source bucket.
+func Move(token string, server string, options Options) error {
+	destBucket, _ := copyDestination(options)
+	sameBucket := destBucket == options.Bucket
+	options.CopyManifest = sameBucket
+	if err := Copy(token, server, options); err != nil {
+		return err
+	}
+	if options.DryRun {
+		fmt.Printf("Would delete %s/%s\n", options.Bucket, options.File)
+		return nil
+	}
+	options.ObjectName = ""
+	if !sameBucket {
+		if err := DeleteWithSegments(token, server, options); err != nil {
+			return fmt.Errorf("copied but failed to delete %s/%s: %s", options.Bucket, options.File, err)
+		}
+		return nil
+	}
+	// segments now belong to the new manifest
+	options.LeaveSegments = true
+	if !DeleteFile(token, server, options) {
+		return fmt.Errorf("copied but failed to delete %s/%s", options.Bucket, options.File)
+	}
+	return nil
+}
+
+// copyWithPrefix applies copy function to all objects matching options.Prefix,
+// options.ObjectName, if set, replaces prefix in destination names
+func copyWithPrefix(token string, server string, options Options, copyFn func(string, string, Options) error) error {
+	files := ListMatching(token, server, options)
+	destPrefix := options.ObjectName
+	nbErrors := 0
+	for _, file := range files {
+		fileOptions := options
+		fileOptions.File = file.Name
+		fileOptions.ObjectName = ""
+		if destPrefix != "" {
+			fileOptions.ObjectName = destPrefix + strings.TrimPrefix(file.Name, options.Prefix)
+		}
+		if err := copyFn(token, server, fileOptions); err != nil {
+			fmt.Printf("Failed to copy %s: %s\n", file.Name, err)
+			nbErrors++
+		}
+	}
+	if nbErrors > 0 {
+		return fmt.Errorf("%d of %d objects failed", nbErrors, len(files))
+	}
+	return nil
+}
+
+// CopyWithPrefix copies all objects matching options.Prefix
+func CopyWithPrefix(token string, server string, options Options) error {
+	return copyWithPrefix(token, server, options, Copy)
+}
+
+// MoveWithPrefix moves all objects matching options.Prefix
+func MoveWithPrefix(token string, server string, options Options) error {
+	return copyWithPrefix(token, server, options, Move)
+}
@@ -0,0 +1,101 @@
+package swift_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftCopy(t *testing.T) {
+	copies := make(map[string]string)
+	var manifest string
+	var deleted []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "HEAD":
+			if req.URL.Path == "/project/large" {
+				res.Header().Set("X-Object-Manifest", "project_segments/large/1/2")
+			}
+			res.Header().Set("X-Object-Meta-Origin", "test")
+			res.WriteHeader(200)
+		case "GET":
+			if req.URL.Path == "/info" {
+				res.WriteHeader(404)
+				return
+			}
+			res.WriteHeader(200)
+			if req.URL.Query().Get("marker") != "" {
+				res.Write([]byte(`[]`))
+				return
+			}
+			res.Write([]byte(`[{"name": "large/1/2/0000000000", "bytes": 1}, {"name": "large/1/2/0000000001", "bytes": 1}]`))
+		case "COPY":
+			copies[req.URL.Path] = req.Header.Get("Destination")
+			res.WriteHeader(201)
+		case "PUT":
+			manifest = req.Header.Get("X-Object-Manifest")
+			res.WriteHeader(201)
+		case "DELETE":
+			deleted = append(deleted, req.URL.Path)
+			res.WriteHeader(204)
+		default:
+			res.WriteHeader(405)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "project", File: "small", DestBucket: "other", ObjectName: "copy"}
+	if err := swift.Copy("123", testServer.URL, options); err != nil {
+		t.Errorf("copy failed: %s", err)
+	}
+	if copies["/project/small"] != "/other/copy" {
+		t.Errorf("wrong destination: %s", copies["/project/small"])
+	}
+
+	options.File = "large"
+	if err := swift.Copy("123", testServer.URL, options); err != nil {
+		t.Errorf("copy failed: %s", err)
+	}
+	if _, ok := copies["/project_segments/large/1/2/0000000001"]; !ok {
+		t.Error("segments not copied")
+	}
+	if manifest == "" {
+		t.Error("manifest not created")
+	}
+
+	options.File = "small"
+	options.DestBucket = ""
+	options.ObjectName = ""
+	if err := swift.Copy("123", testServer.URL, options); err == nil {
+		t.Error("copy on itself should fail")
+	}
+
+	// moved to another bucket, segments are copied and source segments deleted
+	copies = make(map[string]string)
+	options = swift.Options{Bucket: "project", File: "large", DestBucket: "other"}
+	if err := swift.Move("123", testServer.URL, options); err != nil {
+		t.Errorf("move failed: %s", err)
+	}
+	if _, ok := copies["/project_segments/large/1/2/0000000001"]; !ok || !strings.HasPrefix(manifest, "other_segments/large/") {
+		t.Errorf("segments not moved: %v, %s", copies, manifest)
+	}
+	sort.Strings(deleted)
+	if strings.Join(deleted, ",") != "/project/large,/project_segments/large/1/2/0000000000,/project_segments/large/1/2/0000000001" {
+		t.Errorf("wrong deletions: %v", deleted)
+	}
+
+	// moved in same bucket, segments are shared
+	copies = make(map[string]string)
+	deleted = nil
+	options = swift.Options{Bucket: "project", File: "large", ObjectName: "renamed"}
+	if err := swift.Move("123", testServer.URL, options); err != nil {
+		t.Errorf("move failed: %s", err)
+	}
+	if len(copies) != 1 || copies["/project/large"] != "/project/renamed" || len(deleted) != 1 {
+		t.Errorf("segments not shared: %v, %v", copies, deleted)
+	}
+}
@@ -0,0 +1,286 @@
+package swift
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// IgnoreRule is a rule of a gitignore file
+type IgnoreRule struct {
+	Pattern string
+	// Negate re-includes paths matching pattern (!pattern)
+	Negate bool
+	// DirOnly only matches directories (pattern/)
+	DirOnly bool
+}
+
+// Filter selects files by their path, relative to the uploaded or synchronized directory for
+// local files, and relative to the prefix for remote files, so that a filter selects the same
+// files on upload of a directory and on download of its prefix.
+// A prefix is considered as a directory, if it does not end with a complete path element,
+// names are relative to its parent directory.
+//
+// Patterns are globs where * matches within a path element and ** matches any number
+// of path elements. Patterns without slash match files at any depth, like in gitignore files.
+type Filter struct {
+	// Include patterns, if set only matching files are selected
+	Include []string
+	// Exclude patterns, matching files and directories are skipped
+	Exclude []string
+	// Ignore rules read from gitignore syntax files, last matching rule wins
+	Ignore []IgnoreRule
+}
+
+// globSegments splits a pattern in path elements, patterns without slash are
+// matched at any depth and a leading slash anchors pattern
+func globSegments(pattern string) []string {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+// MatchGlob checks if slash separated name matches glob pattern
+func MatchGlob(pattern string, name string) bool {
+	return matchSegments(globSegments(pattern), strings.Split(strings.Trim(name, "/"), "/"))
+}
+
+// ValidateGlob checks glob pattern syntax
+func ValidateGlob(pattern string) error {
+	for _, segment := range globSegments(pattern) {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid pattern %s: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// globPrefix returns the literal part of a glob pattern before its first special character
+func globPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, "*?[\\"); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// regexPrefix returns the literal string following the ^ anchor of a regular expression, if any
+func regexPrefix(re *regexp.Regexp) string {
+	if re == nil {
+		return ""
+	}
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil || parsed.Op != syntax.OpConcat || len(parsed.Sub) < 2 || parsed.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	literal := parsed.Sub[1]
+	if literal.Op != syntax.OpLiteral || literal.Flags&syntax.FoldCase != 0 {
+		return ""
+	}
+	return string(literal.Rune)
+}
+
+// MatchPrefix returns the prefix to list objects matching options.Prefix, options.Match and options.Regex,
+// which is the longest literal prefix of patterns if it extends options.Prefix
+func MatchPrefix(options Options) string {
+	prefix := options.Prefix
+	// match patterns are anchored to object names start, with or without leading /
+	match := strings.TrimPrefix(options.Match, "/")
+	for _, literal := range []string{globPrefix(match), regexPrefix(options.Regex)} {
+		if len(literal) > len(prefix) && strings.HasPrefix(literal, prefix) {
+			prefix = literal
+		}
+	}
+	return prefix
+}
+
+// matchName checks full object name against options.Match and options.Regex
+func matchName(options Options, name string) bool {
+	if options.Match != "" && !MatchGlob("/"+strings.TrimPrefix(options.Match, "/"), name) {
+		return false
+	}
+	if options.Regex != nil && !options.Regex.MatchString(name) {
+		return false
+	}
+	return true
+}
+
+// ParseIgnore parses gitignore syntax rules
+func ParseIgnore(content string) []IgnoreRule {
+	var rules []IgnoreRule
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := IgnoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.Negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\") {
+			// escaped leading ! or #
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.DirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.Pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ReadIgnoreFile reads gitignore syntax rules from a file
+func ReadIgnoreFile(path string) ([]IgnoreRule, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIgnore(string(content)), nil
+}
+
+// Validate checks filter patterns syntax
+func (filter Filter) Validate() error {
+	patterns := append(append([]string{}, filter.Include...), filter.Exclude...)
+	for _, rule := range filter.Ignore {
+		patterns = append(patterns, rule.Pattern)
+	}
+	for _, pattern := range patterns {
+		if err := ValidateGlob(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// excluded checks if a path, without considering its parent directories, is excluded
+func (filter Filter) excluded(name string, isDir bool) bool {
+	for _, pattern := range filter.Exclude {
+		if MatchGlob(pattern, name) {
+			return true
+		}
+	}
+	ignored := false
+	for _, rule := range filter.Ignore {
+		if rule.DirOnly && !isDir {
+			continue
+		}
+		if MatchGlob(rule.Pattern, name) {
+			ignored = !rule.Negate
+		}
+	}
+	return ignored
+}
+
+// SkipDir checks if directory, and all its content, is excluded
+func (filter Filter) SkipDir(name string) bool {
+	name = strings.Trim(name, "/")
+	parent := ""
+	for _, element := range strings.Split(name, "/") {
+		parent = path.Join(parent, element)
+		if filter.excluded(parent, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match checks if file is selected: not excluded, nor in an excluded directory,
+// and matching an include pattern if any
+func (filter Filter) Match(name string) bool {
+	name = strings.Trim(name, "/")
+	if dir := path.Dir(name); dir != "." && filter.SkipDir(dir) {
+		return false
+	}
+	if filter.excluded(name, false) {
+		return false
+	}
+	if len(filter.Include) == 0 {
+		return true
+	}
+	for _, pattern := range filter.Include {
+		if MatchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListMatching lists objects of options.Prefix selected by options.Filter, options.Match and options.Regex
+//
+// Only the literal prefix of patterns is sent to server, remaining parts are matched client side.
+func ListMatching(token string, server string, options Options) []SwiftFile {
+	listOptions := options
+	listOptions.Prefix = MatchPrefix(options)
+	return filterFiles(List(token, server, listOptions), options)
+}
+
+// relativeName returns the name filters apply to, for object name under prefix
+func relativeName(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	dir := prefix
+	if !strings.HasSuffix(dir, "/") && !strings.HasPrefix(name, dir+"/") {
+		// partial path element, data/2020 for data/2020-01.csv
+		dir = path.Dir(dir)
+		if dir == "." {
+			return name
+		}
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(name, dir), "/")
+}
+
+// filterFiles returns files selected by options.Filter, applied to names relative to options.Prefix,
+// and by options.Match and options.Regex, applied to full names
+func filterFiles(files []SwiftFile, options Options) []SwiftFile {
+	var selected []SwiftFile
+	for _, file := range files {
+		if options.Filter.Match(relativeName(options.Prefix, file.Name)) && matchName(options, file.Name) {
+			selected = append(selected, file)
+		} else {
+			logger.Debugf("Skip %s, filtered", file.Name)
+		}
+	}
+	return selected
+}
+
+// WalkFiltered walks dir as filepath.Walk, skipping files and directories rejected by filter,
+// which is applied to slash separated paths relative to dir
+//
+// Symlinked files are walked as their target, symlinked directories are skipped, see WalkLinks.
+func WalkFiltered(dir string, filter Filter, walkFn filepath.WalkFunc) error {
+	return WalkLinks(dir, filter, "", os.Stdout, walkFn)
+}
@@ -0,0 +1,178 @@
+package swift_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftMatchGlob(t *testing.T) {
+	matches := map[string]bool{
+		"*.txt|a.txt":                                    true,
+		"*.txt|dir/sub/a.txt":                            true,
+		"data/*.csv|data/a.csv":                          true,
+		"data/*.csv|data/sub/a.csv":                      false,
+		"data/**/*.csv|data/a.csv":                       true,
+		"data/**/*.csv|data/sub/deep/a.csv":              true,
+		"data/**/*.csv|other/data/a.csv":                 false,
+		"/a.txt|dir/a.txt":                               false,
+		"results/**/sample_*.vcf|results/x/sample_1.vcf": true,
+	}
+	for test, expected := range matches {
+		parts := strings.SplitN(test, "|", 2)
+		if swift.MatchGlob(parts[0], parts[1]) != expected {
+			t.Errorf("MatchGlob(%s, %s) should be %v", parts[0], parts[1], expected)
+		}
+	}
+}
+
+func TestSwiftFilter(t *testing.T) {
+	rules := swift.ParseIgnore("# comment\nbuild/\n*.log\n!keep.log\n\\#hash\n")
+	if len(rules) != 4 || !rules[0].DirOnly || !rules[2].Negate || rules[3].Pattern != "#hash" {
+		t.Fatalf("wrong ignore rules: %+v", rules)
+	}
+	filter := swift.Filter{Exclude: []string{".git"}, Ignore: rules}
+	selected := map[string]bool{
+		"src/main.go":   true,
+		".git/config":   false,
+		"sub/.git/HEAD": false,
+		"build/out.bin": false,
+		"src/build":     true,
+		"debug.log":     false,
+		"logs/keep.log": true,
+		"#hash":         false,
+	}
+	for name, expected := range selected {
+		if filter.Match(name) != expected {
+			t.Errorf("Match(%s) should be %v", name, expected)
+		}
+	}
+	filter = swift.Filter{Include: []string{"**/*.csv"}}
+	if filter.Match("a.txt") || !filter.Match("data/a.csv") {
+		t.Error("include pattern not applied")
+	}
+	if err := (swift.Filter{Exclude: []string{"[a-"}}).Validate(); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestSwiftWalkFiltered(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, ".git", "config"), []byte("x"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("x"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "src", ".main.go.swp"), []byte("x"), 0644)
+
+	var walked []string
+	filter := swift.Filter{Exclude: []string{".git", "*.swp"}}
+	err := swift.WalkFiltered(dir, filter, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			walked = append(walked, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	sort.Strings(walked)
+	if err != nil || strings.Join(walked, ",") != "src/main.go" {
+		t.Errorf("wrong walked files: %v, %v", walked, err)
+	}
+}
+
+func TestSwiftMatchPrefix(t *testing.T) {
+	prefixes := map[string]swift.Options{
+		"results/":       {Match: "results/**/sample_*.vcf.gz"},
+		"data/":          {Prefix: "data/", Match: "*.csv"},
+		"data/2020":      {Prefix: "data/", Regex: regexp.MustCompile(`^data/2020\d{4}\.csv$`)},
+		"other/":         {Prefix: "other/", Match: "data/*.csv"},
+		"":               {Regex: regexp.MustCompile(`data/.*`)},
+		"logs/a":         {Match: "logs/a?", Regex: regexp.MustCompile(`^lo`)},
+		"case/":          {Prefix: "case/", Regex: regexp.MustCompile(`(?i)^case/abc`)},
+		"exact/file.txt": {Match: "exact/file.txt"},
+		"slash/":         {Match: "/slash/*.txt"},
+	}
+	for expected, options := range prefixes {
+		if prefix := swift.MatchPrefix(options); prefix != expected {
+			t.Errorf("MatchPrefix(%+v) is %s, expected %s", options, prefix, expected)
+		}
+	}
+}
+
+func TestSwiftListMatching(t *testing.T) {
+	var listPrefix string
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		if req.URL.Query().Get("marker") != "" {
+			res.Write([]byte(`[]`))
+			return
+		}
+		listPrefix = req.URL.Query().Get("prefix")
+		res.Write([]byte(`[{"name": "results/sample_1.vcf.gz"},
+			{"name": "results/run1/sample_2.vcf.gz"},
+			{"name": "results/run1/sample_2.vcf"},
+			{"name": "results/run1/other.vcf.gz"}]`))
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "project", Match: "results/**/sample_*.vcf.gz"}
+	var names []string
+	for _, file := range swift.ListMatching("123", testServer.URL, options) {
+		names = append(names, file.Name)
+	}
+	if listPrefix != "results/" || strings.Join(names, ",") != "results/sample_1.vcf.gz,results/run1/sample_2.vcf.gz" {
+		t.Errorf("wrong matching files with prefix %s: %v", listPrefix, names)
+	}
+
+	options = swift.Options{Bucket: "project", Regex: regexp.MustCompile(`^results/run\d+/.*\.vcf$`)}
+	names = nil
+	for _, file := range swift.ListMatching("123", testServer.URL, options) {
+		names = append(names, file.Name)
+	}
+	if listPrefix != "results/run" || strings.Join(names, ",") != "results/run1/sample_2.vcf" {
+		t.Errorf("wrong matching files with prefix %s: %v", listPrefix, names)
+	}
+}
+
+func TestSwiftListMatchingRelative(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		if req.URL.Query().Get("marker") != "" {
+			res.Write([]byte(`[]`))
+			return
+		}
+		res.Write([]byte(`[{"name": "localdir/build/out.bin"},
+			{"name": "localdir/src/build/keep.go"},
+			{"name": "localdir/data/a.csv"},
+			{"name": "localdir/src/data/b.csv"}]`))
+	}))
+	defer func() { testServer.Close() }()
+
+	// anchored patterns apply to names relative to prefix, as to paths relative to an uploaded directory
+	for _, prefix := range []string{"localdir", "localdir/", "local"} {
+		options := swift.Options{Bucket: "project", Prefix: prefix, Filter: swift.Filter{Exclude: []string{"/build"}}}
+		if prefix == "local" {
+			options.Filter.Exclude = []string{"/localdir/build"}
+		}
+		var names []string
+		for _, file := range swift.ListMatching("123", testServer.URL, options) {
+			names = append(names, file.Name)
+		}
+		if strings.Join(names, ",") != "localdir/src/build/keep.go,localdir/data/a.csv,localdir/src/data/b.csv" {
+			t.Errorf("wrong files with prefix %s: %v", prefix, names)
+		}
+	}
+	options := swift.Options{Bucket: "project", Prefix: "localdir/", Filter: swift.Filter{Include: []string{"/data/*.csv"}}}
+	files := swift.ListMatching("123", testServer.URL, options)
+	if len(files) != 1 || files[0].Name != "localdir/data/a.csv" {
+		t.Errorf("wrong included files: %v", files)
+	}
+}
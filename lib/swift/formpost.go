@@ -0,0 +1,107 @@
+package swift
+
+import (
+	"fmt"
+	"html"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormPostOptions defines a form to upload files from a browser with formpost middleware
+type FormPostOptions struct {
+	// Redirect is the url browser is redirected to after upload, may be empty
+	Redirect string
+	// MaxFileSize is the maximum size of each uploaded file
+	MaxFileSize int64
+	// MaxFileCount is the maximum number of uploaded files
+	MaxFileCount int64
+	// Expires is the form expiration time
+	Expires time.Time
+	// Key to sign form, container or account Temp-URL-Key if empty
+	Key string
+	// Digest is the signature algorithm: sha1 (default), sha256 or sha512
+	Digest string
+}
+
+// FormPostField is a form field name and value
+type FormPostField struct {
+	Name  string
+	Value string
+}
+
+// FormPost is a signed upload form
+type FormPost struct {
+	// Action is the url form is posted to
+	Action string
+	// Fields are form hidden fields, in form order
+	Fields []FormPostField
+}
+
+// FormPostSignature computes the signature of a form
+//
+// path is the upload path /v1/AUTH_XXX/container/prefix
+func FormPostSignature(key string, digest string, path string, redirect string, maxFileSize int64, maxFileCount int64, expires int64) (string, error) {
+	if digest == "" {
+		digest = "sha1"
+	}
+	body := fmt.Sprintf("%s\n%s\n%d\n%d\n%d", path, redirect, maxFileSize, maxFileCount, expires)
+	return hmacSignature(key, digest, body)
+}
+
+// GenerateFormPost generates a form to upload files in options.Bucket with options.Prefix
+func GenerateFormPost(token string, server string, options Options, form FormPostOptions) (FormPost, error) {
+	result := FormPost{}
+	if form.MaxFileSize <= 0 || form.MaxFileCount <= 0 {
+		return result, fmt.Errorf("max file size and max file count must be positive")
+	}
+	key := form.Key
+	if key == "" {
+		var err error
+		key, err = tempURLKey(token, server, options.Bucket)
+		if err != nil {
+			return result, err
+		}
+	}
+	u, err := neturl.Parse(server)
+	if err != nil {
+		return result, err
+	}
+	path := strings.Join([]string{strings.TrimSuffix(u.Path, "/"), options.Bucket, options.Prefix}, "/")
+	expires := form.Expires.Unix()
+	sig, err := FormPostSignature(key, form.Digest, path, form.Redirect, form.MaxFileSize, form.MaxFileCount, expires)
+	if err != nil {
+		return result, err
+	}
+	u.Path = path
+	result.Action = u.String()
+	result.Fields = []FormPostField{
+		{Name: "redirect", Value: form.Redirect},
+		{Name: "max_file_size", Value: strconv.FormatInt(form.MaxFileSize, 10)},
+		{Name: "max_file_count", Value: strconv.FormatInt(form.MaxFileCount, 10)},
+		{Name: "expires", Value: strconv.FormatInt(expires, 10)},
+		{Name: "signature", Value: sig},
+	}
+	return result, nil
+}
+
+// HTML returns a ready to use html upload form, allowing to select several files if max_file_count is above 1
+func (form FormPost) HTML() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf(`<form action="%s" method="POST" enctype="multipart/form-data">`, html.EscapeString(form.Action)))
+	for _, field := range form.Fields {
+		lines = append(lines, fmt.Sprintf(`  <input type="hidden" name="%s" value="%s" />`, field.Name, html.EscapeString(field.Value)))
+	}
+	fileInput := `  <input type="file" name="file1" />`
+	for _, field := range form.Fields {
+		if count, err := strconv.ParseInt(field.Value, 10, 64); field.Name == "max_file_count" && err == nil && count > 1 {
+			// swift accepts all files of the form, whatever their field name
+			fileInput = `  <input type="file" name="file1" multiple />`
+		}
+	}
+	lines = append(lines, fileInput)
+	lines = append(lines, `  <input type="submit" />`)
+	lines = append(lines, `</form>`)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,48 @@
+package swift_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftFormPost(t *testing.T) {
+	options := swift.Options{Bucket: "project", Prefix: "in/"}
+	form := swift.FormPostOptions{
+		Redirect:     "https://example.com/done",
+		MaxFileSize:  1024,
+		MaxFileCount: 5,
+		Expires:      time.Unix(1500000000, 0),
+		Key:          "secret",
+	}
+	res, err := swift.GenerateFormPost("123", "https://swift.example.com/v1/AUTH_test", options, form)
+	if err != nil {
+		t.Fatalf("failed to generate form: %s", err)
+	}
+	if res.Action != "https://swift.example.com/v1/AUTH_test/project/in/" {
+		t.Errorf("wrong action: %s", res.Action)
+	}
+	fields := make(map[string]string)
+	for _, field := range res.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["signature"] != "37f024d6265e646f15cdf2739857ffadc6248a47" {
+		t.Errorf("wrong signature: %s", fields["signature"])
+	}
+	if fields["max_file_count"] != "5" || fields["expires"] != "1500000000" {
+		t.Errorf("wrong fields: %v", fields)
+	}
+	if !strings.Contains(res.HTML(), `name="signature" value="37f024d6265e646f15cdf2739857ffadc6248a47"`) {
+		t.Error("signature missing in html form")
+	}
+	if !strings.Contains(res.HTML(), `type="file" name="file1" multiple`) {
+		t.Error("html form should allow to select several files")
+	}
+
+	form.MaxFileCount = 0
+	if _, err := swift.GenerateFormPost("123", "https://swift.example.com/v1/AUTH_test", options, form); err == nil {
+		t.Error("form without files should fail")
+	}
+}
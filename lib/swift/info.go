@@ -0,0 +1,160 @@
+package swift
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+)
+
+// ClusterInfo describes cluster capabilities returned by /info, indexed by middleware name
+type ClusterInfo map[string]map[string]interface{}
+
+var infoCache = make(map[string]ClusterInfo)
+var infoErrors = make(map[string]error)
+var infoLock sync.Mutex
+
+// Has checks if cluster supports a feature (swift, slo, bulk_delete, tempurl, ...)
+func (info ClusterInfo) Has(section string) bool {
+	_, ok := info[section]
+	return ok
+}
+
+// Int returns an integer capability
+func (info ClusterInfo) Int(section string, key string) (int64, bool) {
+	values, ok := info[section]
+	if !ok {
+		return 0, false
+	}
+	value, ok := values[key].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int64(value), true
+}
+
+// infoURL returns /info url from storage url https://api.example.com/v1/AUTH_XXX
+func infoURL(server string) (string, error) {
+	u, err := neturl.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	root := ""
+	if index := strings.Index(u.Path, "/v1"); index >= 0 {
+		root = u.Path[:index]
+	}
+	u.Path = root + "/info"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// Capabilities fetches cluster capabilities from /info at storage url root, result is cached per server
+//
+// Definitive answers only are cached, failures to contact server or server errors are retried on next call.
+func Capabilities(token string, server string) (ClusterInfo, error) {
+	infoLock.Lock()
+	defer infoLock.Unlock()
+	if info, ok := infoCache[server]; ok {
+		return info, nil
+	}
+	if err, ok := infoErrors[server]; ok {
+		return nil, err
+	}
+	info, definitive, err := fetchCapabilities(token, server)
+	if err != nil {
+		if definitive {
+			infoErrors[server] = err
+		}
+		return nil, err
+	}
+	infoCache[server] = info
+	return info, nil
+}
+
+// fetchCapabilities gets /info, definitive is false if error may be transient
+func fetchCapabilities(token string, server string) (info ClusterInfo, definitive bool, err error) {
+	url, err := infoURL(server)
+	if err != nil {
+		return nil, true, err
+	}
+	client := &http.Client{}
+	logger.Debugf("Call %s\n", url)
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Add("X-Auth-Token", token)
+	req.Header.Add("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorf("Failed to contact server %s\n", server)
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		logger.Debugf("Info not available: %s\n", resp.Status)
+		// info disabled or not allowed
+		definitive = resp.StatusCode == 404 || resp.StatusCode == 401
+		return nil, definitive, errors.New(resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	info = make(ClusterInfo)
+	if err := json.Unmarshal(body, &info); err != nil {
+		logger.Errorf("Failed to decode answer\n")
+		return nil, false, err
+	}
+	return info, true, nil
+}
+
+// StoragePolicy describes a cluster storage policy
+type StoragePolicy struct {
+	Name string
+	// Aliases is a comma separated list of other names of policy
+	Aliases string
+	Default bool
+}
+
+// StoragePolicies lists cluster storage policies from /info
+func StoragePolicies(token string, server string) ([]StoragePolicy, error) {
+	var policies []StoragePolicy
+	info, err := Capabilities(token, server)
+	if err != nil {
+		return policies, err
+	}
+	values, ok := info["swift"]["policies"].([]interface{})
+	if !ok {
+		return policies, errors.New("cluster does not list storage policies")
+	}
+	for _, value := range values {
+		policy, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		p := StoragePolicy{}
+		p.Name, _ = policy["name"].(string)
+		p.Aliases, _ = policy["aliases"].(string)
+		p.Default, _ = policy["default"].(bool)
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// CheckUpload checks upload options against cluster limits, if available
+func CheckUpload(token string, server string, options Options) error {
+	info, err := Capabilities(token, server)
+	if err != nil {
+		logger.Debugf("Cluster capabilities not available, skip checks: %s", err)
+		return nil
+	}
+	if maxSize, ok := info.Int("swift", "max_file_size"); ok && options.Size > maxSize {
+		return fmt.Errorf("segment size %d is above cluster max_file_size %d", options.Size, maxSize)
+	}
+	if maxName, ok := info.Int("swift", "max_object_name_length"); ok && int64(len(options.ObjectName)) > maxName {
+		return fmt.Errorf("object name %s is longer than cluster max_object_name_length %d", options.ObjectName, maxName)
+	}
+	return nil
+}
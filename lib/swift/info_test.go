@@ -0,0 +1,96 @@
+package swift_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftCapabilities(t *testing.T) {
+	calls := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/info" {
+			calls++
+			res.WriteHeader(200)
+			res.Write([]byte(`{"swift": {"max_file_size": 100, "container_listing_limit": 10000}, "slo": {"max_manifest_segments": 1000}}`))
+			return
+		}
+		res.WriteHeader(404)
+	}))
+	defer func() { testServer.Close() }()
+
+	server := testServer.URL + "/v1/AUTH_test"
+	info, err := swift.Capabilities("123", server)
+	if err != nil {
+		t.Fatalf("failed to get capabilities: %s", err)
+	}
+	if !info.Has("slo") || info.Has("tempurl") {
+		t.Error("wrong middlewares")
+	}
+	if limit, ok := info.Int("swift", "container_listing_limit"); !ok || limit != 10000 {
+		t.Errorf("wrong listing limit: %d", limit)
+	}
+	swift.Capabilities("123", server)
+	if calls != 1 {
+		t.Error("capabilities should be cached")
+	}
+
+	options := swift.Options{Bucket: "project", File: "-", ObjectName: "test", Size: 1000}
+	if err := swift.CheckUpload("123", server, options); err == nil {
+		t.Error("segment size above max_file_size should be refused")
+	}
+	if swift.Upload("123", server, options) {
+		t.Error("upload should be refused")
+	}
+}
+
+func TestSwiftCapabilitiesRetry(t *testing.T) {
+	status := 503
+	calls := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		res.WriteHeader(status)
+		if status == 200 {
+			res.Write([]byte(`{"swift": {}, "bulk_delete": {}}`))
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	server := testServer.URL + "/v1/AUTH_test"
+	if _, err := swift.Capabilities("123", server); err == nil {
+		t.Fatal("server error not reported")
+	}
+	// transient errors are not cached
+	status = 200
+	if info, err := swift.Capabilities("123", server); err != nil || !info.Has("bulk_delete") {
+		t.Errorf("capabilities not fetched again: %v", err)
+	}
+
+	// info disabled on cluster is cached
+	status = 404
+	calls = 0
+	server = testServer.URL + "/v1/AUTH_other"
+	swift.Capabilities("123", server)
+	swift.Capabilities("123", server)
+	if calls != 1 {
+		t.Errorf("missing info should be cached, %d calls", calls)
+	}
+}
+
+func TestSwiftStoragePolicies(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		res.Write([]byte(`{"swift": {"policies": [{"name": "gold", "aliases": "gold, replicated", "default": true}, {"name": "ec"}]}}`))
+	}))
+	defer func() { testServer.Close() }()
+
+	policies, err := swift.StoragePolicies("123", testServer.URL+"/v1/AUTH_test")
+	if err != nil {
+		t.Fatalf("failed to get policies: %s", err)
+	}
+	if len(policies) != 2 || !policies[0].Default || policies[0].Aliases != "gold, replicated" || policies[1].Name != "ec" || policies[1].Default {
+		t.Errorf("wrong policies: %+v", policies)
+	}
+}
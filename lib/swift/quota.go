@@ -0,0 +1,142 @@
+package swift
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Quota describes a container or account quota and its usage, quotas are -1 if not set
+//
+// Swift has no object count quota on accounts.
+type Quota struct {
+	QuotaBytes int64
+	QuotaCount int64
+	Bytes      int64
+	Count      int64
+}
+
+// RemainingBytes returns bytes which can still be stored, -1 if unlimited
+func (q Quota) RemainingBytes() int64 {
+	if q.QuotaBytes < 0 {
+		return -1
+	}
+	if q.Bytes > q.QuotaBytes {
+		return 0
+	}
+	return q.QuotaBytes - q.Bytes
+}
+
+// RemainingCount returns number of objects which can still be stored, -1 if unlimited
+func (q Quota) RemainingCount() int64 {
+	if q.QuotaCount < 0 {
+		return -1
+	}
+	if q.Count > q.QuotaCount {
+		return 0
+	}
+	return q.QuotaCount - q.Count
+}
+
+func headerInt(info map[string]string, name string, undefined int64) int64 {
+	value, err := strconv.ParseInt(info[name], 10, 64)
+	if err != nil {
+		return undefined
+	}
+	return value
+}
+
+// GetQuota gets quota and usage of container options.Bucket, or of account if no bucket is given
+func GetQuota(token string, server string, options Options) (Quota, error) {
+	info, err := Show(token, server, Options{Bucket: options.Bucket})
+	if err != nil {
+		return Quota{QuotaBytes: -1, QuotaCount: -1}, err
+	}
+	if options.Bucket == "" {
+		return Quota{
+			QuotaBytes: headerInt(info, "X-Account-Meta-Quota-Bytes", -1),
+			QuotaCount: -1,
+			Bytes:      headerInt(info, "X-Account-Bytes-Used", 0),
+			Count:      headerInt(info, "X-Account-Object-Count", 0),
+		}, nil
+	}
+	return Quota{
+		QuotaBytes: headerInt(info, "X-Container-Meta-Quota-Bytes", -1),
+		QuotaCount: headerInt(info, "X-Container-Meta-Quota-Count", -1),
+		Bytes:      headerInt(info, "X-Container-Bytes-Used", 0),
+		Count:      headerInt(info, "X-Container-Object-Count", 0),
+	}, nil
+}
+
+// SetQuota sets quotas of container options.Bucket, or byte quota of account if no bucket is given
+//
+// Negative values leave quota unchanged, 0 removes it. Account quota can only be set by a reseller admin.
+func SetQuota(token string, server string, options Options, quotaBytes int64, quotaCount int64) error {
+	level := "Container"
+	if options.Bucket == "" {
+		level = "Account"
+		if quotaCount >= 0 {
+			return fmt.Errorf("object count quota is not supported on account")
+		}
+	}
+	headers := make(map[string]string)
+	if quotaBytes > 0 {
+		headers["X-"+level+"-Meta-Quota-Bytes"] = strconv.FormatInt(quotaBytes, 10)
+	} else if quotaBytes == 0 {
+		headers["X-Remove-"+level+"-Meta-Quota-Bytes"] = "x"
+	}
+	if quotaCount > 0 {
+		headers["X-Container-Meta-Quota-Count"] = strconv.FormatInt(quotaCount, 10)
+	} else if quotaCount == 0 {
+		headers["X-Remove-Container-Meta-Quota-Count"] = "x"
+	}
+	if len(headers) == 0 {
+		return fmt.Errorf("no quota to update")
+	}
+	return postHeaders(token, server, options.Bucket, "", headers)
+}
+
+func checkQuota(token string, server string, options Options, bytes int64, count int64) error {
+	name := options.Bucket
+	if name == "" {
+		name = "account"
+	}
+	quota, err := GetQuota(token, server, options)
+	if err != nil {
+		logger.Debugf("Quota of %s not available, skip check: %s", name, err)
+		return nil
+	}
+	if remaining := quota.RemainingBytes(); remaining >= 0 && bytes > remaining {
+		return fmt.Errorf("upload of %d bytes exceeds %s quota, %d bytes remaining out of %d", bytes, name, remaining, quota.QuotaBytes)
+	}
+	if remaining := quota.RemainingCount(); remaining >= 0 && count > remaining {
+		return fmt.Errorf("upload of %d objects exceeds %s quota, %d objects remaining out of %d", count, name, remaining, quota.QuotaCount)
+	}
+	return nil
+}
+
+// CheckQuota checks that files of sizes can be uploaded in options.Bucket without exceeding
+// container or account quotas
+//
+// Files larger than options.Size are accounted as segments in the segments container.
+// Overwritten objects are not deducted, so check may fail although upload would fit.
+func CheckQuota(token string, server string, options Options, sizes []int64) error {
+	var bytes, segmentBytes, count, segmentCount int64
+	for _, size := range sizes {
+		count++
+		if options.Size > 0 && size > options.Size {
+			segmentBytes += size
+			segmentCount += (size + options.Size - 1) / options.Size
+		} else {
+			bytes += size
+		}
+	}
+	if err := checkQuota(token, server, Options{Bucket: options.Bucket}, bytes, count); err != nil {
+		return err
+	}
+	if segmentCount > 0 {
+		if err := checkQuota(token, server, segmentOptions(options), segmentBytes, segmentCount); err != nil {
+			return err
+		}
+	}
+	return checkQuota(token, server, Options{}, bytes+segmentBytes, count+segmentCount)
+}
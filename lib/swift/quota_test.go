@@ -0,0 +1,68 @@
+package swift_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftCheckQuota(t *testing.T) {
+	var posted http.Header
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "HEAD" && req.URL.Path == "/project/":
+			res.Header().Set("X-Container-Meta-Quota-Bytes", "100")
+			res.Header().Set("X-Container-Meta-Quota-Count", "3")
+			res.Header().Set("X-Container-Bytes-Used", "40")
+			res.Header().Set("X-Container-Object-Count", "1")
+			res.WriteHeader(204)
+		case req.Method == "HEAD" && req.URL.Path == "/project_segments/":
+			res.Header().Set("X-Container-Bytes-Used", "0")
+			res.WriteHeader(204)
+		case req.Method == "HEAD":
+			res.Header().Set("X-Account-Meta-Quota-Bytes", "1000")
+			res.Header().Set("X-Account-Bytes-Used", "500")
+			res.WriteHeader(204)
+		case req.Method == "POST":
+			posted = req.Header
+			res.WriteHeader(204)
+		default:
+			res.WriteHeader(404)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "project", Size: 100}
+	q, err := swift.GetQuota("123", testServer.URL, options)
+	if err != nil || q.RemainingBytes() != 60 || q.RemainingCount() != 2 {
+		t.Fatalf("wrong quota: %+v, %v", q, err)
+	}
+	if err := swift.CheckQuota("123", testServer.URL, options, []int64{30, 30}); err != nil {
+		t.Errorf("upload within quota refused: %s", err)
+	}
+	if err := swift.CheckQuota("123", testServer.URL, options, []int64{30, 31}); err == nil {
+		t.Errorf("upload above container bytes quota accepted")
+	}
+	if err := swift.CheckQuota("123", testServer.URL, options, []int64{1, 1, 1}); err == nil {
+		t.Errorf("upload above container count quota accepted")
+	}
+	// large file goes to segments container, only account quota applies
+	if err := swift.CheckQuota("123", testServer.URL, options, []int64{400}); err != nil {
+		t.Errorf("segmented upload within quota refused: %s", err)
+	}
+	if err := swift.CheckQuota("123", testServer.URL, options, []int64{600}); err == nil {
+		t.Errorf("upload above account quota accepted")
+	}
+
+	if err := swift.SetQuota("123", testServer.URL, options, 0, 10); err != nil {
+		t.Fatalf("failed to set quota: %s", err)
+	}
+	if posted.Get("X-Remove-Container-Meta-Quota-Bytes") == "" || posted.Get("X-Container-Meta-Quota-Count") != "10" {
+		t.Errorf("wrong quota headers: %v", posted)
+	}
+	if err := swift.SetQuota("123", testServer.URL, swift.Options{}, -1, 10); err == nil {
+		t.Errorf("account count quota accepted")
+	}
+}
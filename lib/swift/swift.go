@@ -1,6 +1,7 @@
 package swift
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -8,9 +9,11 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +32,50 @@ type Options struct {
 	Prefix        string
 	LeaveSegments bool
 	Meta          map[string]string
+	// ContentType of uploaded object, detected from file if empty
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+	// Headers are additional request headers set on uploaded objects
+	Headers map[string]string
+	// RemoveMeta lists meta data keys to remove on post
+	RemoveMeta []string
+	// StoragePolicy of created containers, cluster default if empty
+	StoragePolicy string
+	// Recursive deletes container content before container itself
+	Recursive bool
+	// DestBucket is the destination bucket of copy/move, same bucket if empty
+	DestBucket string
+	// FreshMetadata drops source meta data on copy
+	FreshMetadata bool
+	// CopyManifest copies large object manifests instead of data
+	CopyManifest bool
+	// ArchiveFormat of extract-archive uploads, tar or tar.gz
+	ArchiveFormat string
+	// DeleteAt is the unix time uploaded objects, and their segments, expire at
+	DeleteAt int64
+	// VersionID selects a version of a versioned object
+	VersionID string
+	// DeleteExtra removes destination files missing from source on sync
+	DeleteExtra bool
+	// DryRun prints what would be done without modifying anything
+	DryRun bool
+	// ConfirmAbove asks for confirmation on stdin before deleting more objects, 0 never asks
+	ConfirmAbove int
+	// Filter selects files of directory and prefix operations
+	Filter Filter
+	// Match is a glob pattern full object names of prefix operations must match
+	Match string
+	// Regex is a regular expression object names of prefix operations must match
+	Regex *regexp.Regexp
+	// ObjectThreads is the number of objects of prefix downloads and deletes processed concurrently
+	ObjectThreads int
+	// Output receives progress messages of object operations, stdout if nil
+	Output io.Writer
+	// Symlinks policy of directory uploads, SymlinksFollow, SymlinksSkip or SymlinksStore,
+	// symlinked files are uploaded and symlinked directories skipped if empty.
+	// With SymlinksStore, downloaded symlink objects are restored as symlinks
+	Symlinks string
 }
 
 // SwiftFile describe a swift object
@@ -40,19 +87,107 @@ type SwiftFile struct {
 	ContentType  string `json:"content_type"`
 }
 
+// SwiftContainer describe a swift container
+type SwiftContainer struct {
+	Name         string
+	Count        uint64
+	Bytes        uint64
+	LastModified string `json:"last_modified"`
+}
+
 type Segment struct {
 	From int64
 	Size int64
 }
 
-func fileSize(path string) int64 {
+// DirectoryContentType is the content type of directory marker objects
+const DirectoryContentType = "application/directory"
+
+func fileSize(path string) (int64, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		logger.Errorf("%s", err)
-		return 0
+		return 0, err
+	}
+	if fi.IsDir() {
+		return 0, fmt.Errorf("%s is a directory", path)
+	}
+
+	return fi.Size(), nil
+}
+
+// DetectContentType guesses the content type of a local file
+//
+// Content type is taken from file extension if known, else from the first 512 bytes of the file
+func DetectContentType(path string) string {
+	if ctype := mime.TypeByExtension(filepath.Ext(path)); ctype != "" {
+		return ctype
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
 	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	if n == 0 {
+		return ""
+	}
+	return http.DetectContentType(buf[:n])
+}
 
-	return fi.Size()
+// ParseHeader parses a "Name: value" header definition
+//
+// Value is everything after the first colon, so it may contain colons itself
+func ParseHeader(header string) (name string, value string, err error) {
+	kv := strings.SplitN(header, ":", 2)
+	if len(kv) != 2 {
+		return "", "", fmt.Errorf("invalid header %q, expecting Name: value", header)
+	}
+	name = strings.TrimSpace(kv[0])
+	value = strings.TrimSpace(kv[1])
+	if !validHeaderName(name) {
+		return "", "", fmt.Errorf("invalid header name %q", name)
+	}
+	return name, value, nil
+}
+
+// validHeaderName checks name only contains RFC 7230 token characters
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// expirationHeaders are the headers managing object expiration
+var expirationHeaders = []string{"X-Delete-At", "X-Delete-After", "X-Remove-Delete-At"}
+
+func setObjectHeaders(req *http.Request, options Options) {
+	if options.DeleteAt > 0 {
+		req.Header.Set("X-Delete-At", strconv.FormatInt(options.DeleteAt, 10))
+	}
+	if options.ContentType != "" {
+		req.Header.Set("Content-Type", options.ContentType)
+	}
+	if options.ContentEncoding != "" {
+		req.Header.Set("Content-Encoding", options.ContentEncoding)
+	}
+	if options.ContentDisposition != "" {
+		req.Header.Set("Content-Disposition", options.ContentDisposition)
+	}
+	// explicit headers take precedence
+	for h := range options.Headers {
+		req.Header.Set(h, options.Headers[h])
+	}
 }
 
 func uploadManifest(token string, server string, segmentPrefix string, options Options) bool {
@@ -64,33 +199,34 @@ func uploadManifest(token string, server string, segmentPrefix string, options O
 	req, _ := http.NewRequest("PUT", strings.Join(url, "/"), bytes.NewReader(byteData))
 	req.Header.Add("X-Auth-Token", token)
 	req.Header.Add("X-Object-Manifest", segmentPrefix)
+	setObjectHeaders(req, options)
 	for m := range options.Meta {
 		logger.Debugf("Add metadata %s: %s\n", m, options.Meta[m])
 		req.Header.Add("X-Object-Meta-"+m, options.Meta[m])
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		logger.Errorf("Failed to contact server %s\n", server)
+		printf(options, "Failed to contact server %s\n", server)
 		return false
 	}
 	if resp.StatusCode != 201 {
-		logger.Errorf("Failed to upload file: %s", resp.Status)
+		printf(options, "Failed to upload file: %s\n", resp.Status)
 		return false
 	} else {
 		logger.Debugf("Manifest uploaded => %s", strings.Join(url, "/"))
 		jobids := resp.Header.Get("X-HERO-JOBS")
 		if jobids != "" {
-			printJobIds(jobids)
+			printJobIds(options, jobids)
 		}
 		return true
 	}
 }
 
-func printJobIds(ids string) {
-	fmt.Printf("Submitted jobs:\n")
+func printJobIds(options Options, ids string) {
+	printf(options, "Submitted jobs:\n")
 	jobs := strings.Split(ids, ",")
 	for _, j := range jobs {
-		fmt.Printf("\t%s\n", j)
+		printf(options, "\t%s\n", j)
 	}
 }
 
@@ -105,7 +241,7 @@ func uploadSegment(ch chan bool, token string, server string, options Options, s
 	body = bytes.NewReader(byteData)
 
 	if derr != nil {
-		logger.Errorf("Failed to open file %s", options.File)
+		printf(options, "Failed to open file %s\n", options.File)
 		ch <- false
 		return
 	}
@@ -117,22 +253,26 @@ func uploadSegment(ch chan bool, token string, server string, options Options, s
 
 	req, _ := http.NewRequest("PUT", strings.Join(segurl, "/"), body)
 	req.Header.Add("X-Auth-Token", token)
+	setObjectHeaders(req, options)
 	for m := range options.Meta {
 		req.Header.Add("X-Object-Meta-"+m, options.Meta[m])
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		logger.Errorf("Failed to contact server %s\n", server)
+		printf(options, "Failed to contact server %s\n", server)
 		ch <- false
 		return
 	}
-	if resp.StatusCode != 201 {
-		logger.Errorf("Failed to upload file: %s", resp.Status)
+	if resp.StatusCode == 404 {
+		printf(options, "Failed to upload file: %s, bucket %s does not exist\n", resp.Status, options.Bucket)
+		ch <- false
+	} else if resp.StatusCode != 201 {
+		printf(options, "Failed to upload file: %s\n", resp.Status)
 		ch <- false
 	} else {
 		jobids := resp.Header.Get("X-HERO-JOBS")
 		if jobids != "" {
-			printJobIds(jobids)
+			printJobIds(options, jobids)
 		}
 		ch <- true
 	}
@@ -147,12 +287,13 @@ func Head(token string, server string, options Options) string {
 	client := &http.Client{}
 	url := []string{server, options.Bucket, options.ObjectName}
 	logger.Debugf("Call %s\n", strings.Join(url, "/"))
-	req, _ := http.NewRequest("HEAD", strings.Join(url, "/"), nil)
+	// do not follow symlinks, segments of their target must not be deleted with them
+	req, _ := http.NewRequest("HEAD", strings.Join(url, "/")+"?symlink=get", nil)
 	req.Header.Add("X-Auth-Token", token)
 	req.Header.Add("Accept", "application/json")
 	resp, err := client.Do(req)
 	if err != nil {
-		logger.Errorf("Failed to contact server %s\n", server)
+		printf(options, "Failed to contact server %s\n", server)
 		return manifest
 	}
 	defer resp.Body.Close()
@@ -177,7 +318,7 @@ func Show(token string, server string, options Options) (data map[string]string,
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Errorf("Failed to contact server %s\n", server)
-		return data, errors.New(resp.Status)
+		return data, err
 	}
 	if resp.StatusCode != 200 && resp.StatusCode != 204 {
 		logger.Errorf("Error %s\n", resp.Status)
@@ -191,18 +332,327 @@ func Show(token string, server string, options Options) (data map[string]string,
 	return data, nil
 }
 
+func uploadStreamSegment(token string, server string, options Options, body io.Reader) bool {
+	client := &http.Client{}
+	segurl := []string{server, options.Bucket, options.ObjectName}
+	logger.Debugf("Call %s\n", strings.Join(segurl, "/"))
+
+	req, _ := http.NewRequest("PUT", strings.Join(segurl, "/"), body)
+	// size is unknown, force chunked transfer encoding
+	req.ContentLength = -1
+	req.Header.Add("X-Auth-Token", token)
+	setObjectHeaders(req, options)
+	for m := range options.Meta {
+		req.Header.Add("X-Object-Meta-"+m, options.Meta[m])
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		printf(options, "Failed to contact server %s\n", server)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 201 {
+		printf(options, "Failed to upload file: %s\n", resp.Status)
+		return false
+	}
+	jobids := resp.Header.Get("X-HERO-JOBS")
+	if jobids != "" {
+		printJobIds(options, jobids)
+	}
+	return true
+}
+
+// uploadStream uploads reader content as a segmented object.
+//
+// Total size is unknown, so content is always split in segments of options.Size
+// bytes, each sent with chunked transfer encoding, followed by the manifest.
+func uploadStream(token string, server string, reader io.Reader, options Options) bool {
+	in := bufio.NewReader(reader)
+	if options.ContentType == "" {
+		if sniff, _ := in.Peek(512); len(sniff) > 0 {
+			options.ContentType = http.DetectContentType(sniff)
+		}
+	}
+
+	segOptions := segmentOptions(options)
+	ts := strconv.FormatInt(time.Now().UnixNano(), 10)
+	segmentPrefix := []string{segOptions.Bucket, options.ObjectName, ts, "stream"}
+	for i := int64(0); ; i++ {
+		if _, err := in.Peek(1); err != nil {
+			if err != io.EOF {
+				printf(options, "Failed to read input: %s\n", err)
+				return false
+			}
+			break
+		}
+		index := fmt.Sprintf("%010d", i)
+		segOptions.ObjectName = strings.Join([]string{options.ObjectName, ts, "stream", index}, "/")
+		logger.Debugf("create stream segment %d", i)
+		if !uploadStreamSegment(token, server, segOptions, io.LimitReader(in, options.Size)) {
+			printf(options, "Failed to upload file segment\n")
+			return false
+		}
+		printf(options, "Segment uploaded!\n")
+	}
+
+	return uploadManifest(token, server, strings.Join(segmentPrefix, "/"), options)
+}
+
+// segmentOptions returns options to upload segments of an object
+//
+// Segments are stored in <bucket>_segments, object level headers only apply to manifest,
+// except expiration, segments must expire with their manifest
+func segmentOptions(options Options) Options {
+	options.Bucket = options.Bucket + "_segments"
+	options.ContentType = ""
+	options.ContentEncoding = ""
+	options.ContentDisposition = ""
+	headers := make(map[string]string)
+	for h, v := range options.Headers {
+		for _, e := range expirationHeaders {
+			if http.CanonicalHeaderKey(h) == e {
+				headers[h] = v
+			}
+		}
+	}
+	options.Headers = headers
+	return options
+}
+
+// fixExpiration replaces a X-Delete-After header by options.DeleteAt, so that segments,
+// uploaded one after the other, and manifest expire at the same time
+func fixExpiration(options Options) Options {
+	headers := make(map[string]string)
+	for h, v := range options.Headers {
+		if http.CanonicalHeaderKey(h) == "X-Delete-After" {
+			if after, err := strconv.ParseInt(v, 10, 64); err == nil {
+				options.DeleteAt = time.Now().Unix() + after
+				continue
+			}
+		}
+		headers[h] = v
+	}
+	options.Headers = headers
+	return options
+}
+
+// manifestLocation splits a X-Object-Manifest value in segments container and prefix
+func manifestLocation(manifest string) (container string, prefix string) {
+	parts := strings.SplitN(strings.TrimPrefix(manifest, "/"), "/", 2)
+	if len(parts) != 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// deleteSegments deletes segments referenced by a manifest
+func deleteSegments(token string, server string, manifest string, options Options) {
+	logger.Debugf("Delete segments of manifest %s", manifest)
+	options.Bucket, options.Prefix = manifestLocation(manifest)
+	if options.Prefix == "" {
+		logger.Errorf("Invalid manifest %s, segments not deleted", manifest)
+		return
+	}
+	segments := List(token, server, options)
+	logger.Debugf("Delete segment files")
+	var paths []string
+	for _, file := range segments {
+		printf(options, "Delete segment %s, size: %d, last: %s\n", file.Name, file.Bytes, file.LastModified)
+		paths = append(paths, objectPath(options.Bucket, file.Name))
+	}
+	printBulkDeleteResult(output(options), BulkDelete(token, server, paths))
+}
+
+// object headers kept on post, object post replaces all object meta data
+var postPreservedHeaders = []string{
+	"Content-Disposition",
+	"Content-Encoding",
+	"X-Delete-At",
+	"X-Object-Manifest",
+}
+
+// Post updates account, container (options.Bucket) or object (options.File) meta data
+//
+// options.Meta are set, options.RemoveMeta are removed, and options.Headers are sent as is.
+// As Swift replaces all meta data of an object on post, current object meta data are fetched and sent again.
+// Expiration changes of a large object are applied to its segments too.
+func Post(token string, server string, options Options) error {
+	level := "Account"
+	if options.Bucket != "" {
+		level = "Container"
+	}
+	if options.File != "" {
+		level = "Object"
+	}
+	metaPrefix := "X-" + level + "-Meta-"
+	headers := make(map[string]string)
+	if options.ContentType != "" {
+		headers["Content-Type"] = options.ContentType
+	}
+	if options.DeleteAt > 0 {
+		headers["X-Delete-At"] = strconv.FormatInt(options.DeleteAt, 10)
+	}
+	for h := range options.Headers {
+		headers[http.CanonicalHeaderKey(h)] = options.Headers[h]
+	}
+	expiration := make(map[string]string)
+	for _, h := range expirationHeaders {
+		if v, ok := headers[h]; ok {
+			expiration[h] = v
+		}
+	}
+	manifest := ""
+	if level == "Object" {
+		current, err := Show(token, server, options)
+		if err != nil {
+			return err
+		}
+		manifest = current["X-Object-Manifest"]
+		keepObjectHeaders(current, headers, expiration)
+		for _, m := range options.RemoveMeta {
+			delete(headers, http.CanonicalHeaderKey(metaPrefix+m))
+		}
+	} else {
+		for _, m := range options.RemoveMeta {
+			headers[http.CanonicalHeaderKey("X-Remove-"+level+"-Meta-"+m)] = "x"
+		}
+	}
+	for m := range options.Meta {
+		headers[http.CanonicalHeaderKey(metaPrefix+m)] = options.Meta[m]
+	}
+
+	if err := postHeaders(token, server, options.Bucket, options.File, headers); err != nil {
+		return err
+	}
+	if manifest != "" && len(expiration) > 0 {
+		// segments must expire with manifest
+		segOptions := options
+		segOptions.Bucket, segOptions.Prefix = manifestLocation(manifest)
+		if segOptions.Prefix == "" {
+			return nil
+		}
+		for _, segment := range List(token, server, segOptions) {
+			current, err := Show(token, server, Options{Bucket: segOptions.Bucket, File: segment.Name})
+			if err != nil {
+				return fmt.Errorf("failed to get segment %s: %s", segment.Name, err)
+			}
+			segmentHeaders := make(map[string]string)
+			for k, v := range expiration {
+				segmentHeaders[k] = v
+			}
+			keepObjectHeaders(current, segmentHeaders, expiration)
+			if err := postHeaders(token, server, segOptions.Bucket, segment.Name, segmentHeaders); err != nil {
+				return fmt.Errorf("failed to update segment %s: %s", segment.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// keepObjectHeaders adds current meta data and preserved headers of an object to posted headers,
+// as object post replaces them, unless headers set them or expiration is updated
+func keepObjectHeaders(current map[string]string, headers map[string]string, expiration map[string]string) {
+	for k, v := range current {
+		if _, set := headers[k]; !set && strings.HasPrefix(k, "X-Object-Meta-") {
+			headers[k] = v
+		}
+	}
+	for _, k := range postPreservedHeaders {
+		if k == "X-Delete-At" && len(expiration) > 0 {
+			// expiration is updated
+			continue
+		}
+		if v, ok := current[k]; ok {
+			if _, set := headers[k]; !set {
+				headers[k] = v
+			}
+		}
+	}
+}
+
+// postHeaders sends a POST request with headers to account, container or object
+func postHeaders(token string, server string, bucket string, object string, headers map[string]string) error {
+	client := &http.Client{}
+	url := []string{server, bucket, object}
+	logger.Debugf("Call %s\n", strings.Join(url, "/"))
+	req, _ := http.NewRequest("POST", strings.Join(url, "/"), nil)
+	req.Header.Add("X-Auth-Token", token)
+	for k, v := range headers {
+		logger.Debugf("Set header %s: %s", k, v)
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorf("Failed to contact server %s\n", server)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		logger.Errorf("Error %s\n", resp.Status)
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
 // Upload uploads a file to swift
+//
+// If options.File is "-", content is read from stdin and options.ObjectName is mandatory
 func Upload(token string, server string, options Options) bool {
+	if options.File == "-" {
+		if options.ObjectName == "" || options.ObjectName == "-" {
+			printf(options, "Object name is required to upload from stdin\n")
+			return false
+		}
+	}
+	if options.Size <= 0 {
+		// content would be split in empty segments forever
+		printf(options, "Invalid segment size %d, must be positive\n", options.Size)
+		return false
+	}
 	if options.ObjectName == "" {
 		options.ObjectName = options.File
 	}
 	options.ObjectName = strings.TrimPrefix(options.ObjectName, "/")
-	fmt.Printf("Upload: %s => %s\n", options.File, options.ObjectName)
+	options = fixExpiration(options)
+	if !options.DryRun {
+		printf(options, "Upload: %s => %s\n", options.File, options.ObjectName)
+	}
 	url := []string{server, options.Bucket, options.ObjectName}
 	logger.Debugf("Call %s\n", strings.Join(url, "/"))
-	fSize := fileSize(options.File)
-	if fSize == 0 {
-		fmt.Printf("File not found or empty\n")
+	if err := CheckUpload(token, server, options); err != nil {
+		printf(options, "Upload refused: %s\n", err)
+		return false
+	}
+
+	if options.ContentType == "" {
+		// stdin content is sniffed when streamed
+		options.ContentType = mime.TypeByExtension(filepath.Ext(options.ObjectName))
+		if options.ContentType == "" && options.File != "-" {
+			options.ContentType = DetectContentType(options.File)
+		}
+	}
+	logger.Debugf("Content type: %s", options.ContentType)
+
+	if options.File == "-" {
+		oldManifest := Head(token, server, options)
+		if options.DryRun {
+			printf(options, "Would upload stdin => %s, in segments of %d bytes\n", options.ObjectName, options.Size)
+			return true
+		}
+		if !uploadStream(token, server, os.Stdin, options) {
+			printf(options, "Failed to upload file\n")
+			return false
+		}
+		printf(options, "Uploaded!\n")
+		if oldManifest != "" && !keepSegments(token, server, options) {
+			deleteSegments(token, server, oldManifest, options)
+		}
+		return true
+	}
+
+	fSize, sizeErr := fileSize(options.File)
+	if sizeErr != nil {
+		printf(options, "File not found: %s\n", sizeErr)
 		return false
 	}
 
@@ -211,18 +661,30 @@ func Upload(token string, server string, options Options) bool {
 	// need to query files with prefix defined in manifest to delete them
 	oldManifest := Head(token, server, options)
 
+	if options.DryRun {
+		nbSegment := int64(0)
+		if fSize > options.Size {
+			nbSegment = int64(math.Floor(float64(fSize)/float64(options.Size)) + 1)
+		}
+		printf(options, "Would upload %s => %s, %d bytes, %d segments\n", options.File, options.ObjectName, fSize, nbSegment)
+		if oldManifest != "" && !keepSegments(token, server, options) {
+			printf(options, "Would delete old segments %s\n", oldManifest)
+		}
+		return true
+	}
+
+	uploaded := true
 	if fSize > options.Size {
 		nbSegment := int64(math.Floor(float64(fSize)/float64(options.Size)) + 1)
 		start := int64(0)
 		size := int64(0)
 		ch := make(chan bool)
 		uploadDone := int64(0)
-		project := options.Bucket
 		origFile := options.ObjectName
-		options.Bucket = options.Bucket + "_segments"
+		segOptions := segmentOptions(options)
 		ts := time.Now().UnixNano()
 
-		segmentPrefix := []string{options.Bucket, options.ObjectName, strconv.FormatInt(ts, 10), strconv.FormatInt(fSize, 10)}
+		segmentPrefix := []string{segOptions.Bucket, options.ObjectName, strconv.FormatInt(ts, 10), strconv.FormatInt(fSize, 10)}
 		for i := int64(0); i < nbSegment; i++ {
 			segmentSize := options.Size
 			if i == nbSegment-1 {
@@ -233,14 +695,15 @@ func Upload(token string, server string, options Options) bool {
 			index := fmt.Sprintf("%010d", i)
 			segmentFileName := []string{origFile, strconv.FormatInt(ts, 10), strconv.FormatInt(fSize, 10), index}
 			newObjectName := strings.Join(segmentFileName, "/")
-			options.ObjectName = newObjectName
-			go uploadSegment(ch, token, server, options, segment)
+			segOptions.ObjectName = newObjectName
+			go uploadSegment(ch, token, server, segOptions, segment)
 
 			uploadRes := <-ch
 			if !uploadRes {
-				fmt.Printf("Failed to upload file segment\n")
+				printf(options, "Failed to upload file segment\n")
+				uploaded = false
 			} else {
-				fmt.Println("Segment uploaded!")
+				printf(options, "Segment uploaded!\n")
 			}
 			uploadDone++
 
@@ -251,17 +714,19 @@ func Upload(token string, server string, options Options) bool {
 			for uploadDone < nbSegment {
 				uploadRes := <-ch
 				if !uploadRes {
-					fmt.Printf("Failed to upload file segment\n")
+					printf(options, "Failed to upload file segment\n")
 				} else {
-					fmt.Println("Segment uploaded!")
+					printf(options, "Segment uploaded!\n")
 				}
 				uploadDone++
 			}
 		*/
 		close(ch)
-		options.Bucket = project
-		options.ObjectName = origFile
-		uploadManifest(token, server, strings.Join(segmentPrefix, "/"), options)
+		if !uploaded {
+			// keep previous object rather than a manifest with missing segments
+			return false
+		}
+		uploaded = uploadManifest(token, server, strings.Join(segmentPrefix, "/"), options)
 
 	} else {
 		ch := make(chan bool)
@@ -269,66 +734,263 @@ func Upload(token string, server string, options Options) bool {
 		go uploadSegment(ch, token, server, options, segment)
 		uploadRes := <-ch
 		if !uploadRes {
-			fmt.Printf("Failed to upload file\n")
+			printf(options, "Failed to upload file\n")
 		} else {
-			fmt.Println("Uploaded!")
+			printf(options, "Uploaded!\n")
 		}
+		uploaded = uploadRes
 		close(ch)
 	}
+	if !uploaded {
+		return false
+	}
 
-	if oldManifest != "" && options.LeaveSegments == false {
-		logger.Debugf("Delete old segments")
-		logger.Debugf("List with manifest prefix in _segments")
-		options.Prefix = strings.Replace(oldManifest, options.Bucket+"_segments/", "", -1)
-		options.Bucket = options.Bucket + "_segments"
-		oldFiles := List(token, server, options)
-		logger.Debugf("Delete old segment files")
-		for _, file := range oldFiles {
-			options.File = file.Name
-			fmt.Printf("Delete segment %s, size: %d, last: %s\n", file.Name, file.Bytes, file.LastModified)
-			DeleteFile(token, server, options)
-		}
+	if oldManifest != "" && !keepSegments(token, server, options) {
+		deleteSegments(token, server, oldManifest, options)
 	}
 	return true
 }
 
-// DeleteWithPrefix deletes all files matching prefix
-func DeleteWithPrefix(token string, server string, options Options) {
+// UploadDirMarker creates a zero-byte directory marker object named options.ObjectName
+func UploadDirMarker(token string, server string, options Options) bool {
+	if options.ObjectName == "" {
+		options.ObjectName = options.File
+	}
+	options.ObjectName = strings.TrimSuffix(strings.TrimPrefix(options.ObjectName, "/"), "/")
+	if options.DryRun {
+		printf(options, "Would create directory marker: %s\n", options.ObjectName)
+		return true
+	}
+	printf(options, "Create directory marker: %s\n", options.ObjectName)
+	client := &http.Client{}
+	url := []string{server, options.Bucket, options.ObjectName}
+	logger.Debugf("Call %s\n", strings.Join(url, "/"))
+	req, _ := http.NewRequest("PUT", strings.Join(url, "/"), bytes.NewReader([]byte{}))
+	req.Header.Add("X-Auth-Token", token)
+	req.Header.Add("Content-Type", DirectoryContentType)
+	for m := range options.Meta {
+		req.Header.Add("X-Object-Meta-"+m, options.Meta[m])
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		printf(options, "Failed to contact server %s\n", server)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 201 {
+		printf(options, "Failed to create directory marker: %s\n", resp.Status)
+		return false
+	}
+	return true
+}
+
+// ContainerExists checks if container exists
+func ContainerExists(token string, server string, bucket string) (bool, error) {
+	client := &http.Client{}
+	url := []string{server, bucket}
+	logger.Debugf("Call %s\n", strings.Join(url, "/"))
+	req, _ := http.NewRequest("HEAD", strings.Join(url, "/"), nil)
+	req.Header.Add("X-Auth-Token", token)
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorf("Failed to contact server %s\n", server)
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		return false, nil
+	}
+	if resp.StatusCode != 200 && resp.StatusCode != 204 {
+		logger.Errorf("Error %s\n", resp.Status)
+		return false, errors.New(resp.Status)
+	}
+	return true, nil
+}
+
+// CreateContainer creates container options.Bucket
+//
+// options.Meta are set as container meta data and options.Headers sent as is
+func CreateContainer(token string, server string, options Options) error {
+	if options.DryRun {
+		fmt.Printf("Would create bucket %s\n", options.Bucket)
+		return nil
+	}
+	client := &http.Client{}
+	url := []string{server, options.Bucket}
+	logger.Debugf("Call %s\n", strings.Join(url, "/"))
+	req, _ := http.NewRequest("PUT", strings.Join(url, "/"), nil)
+	req.Header.Add("X-Auth-Token", token)
+	if options.StoragePolicy != "" {
+		req.Header.Add("X-Storage-Policy", options.StoragePolicy)
+	}
+	for m := range options.Meta {
+		req.Header.Add("X-Container-Meta-"+m, options.Meta[m])
+	}
+	for h := range options.Headers {
+		req.Header.Set(h, options.Headers[h])
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorf("Failed to contact server %s\n", server)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 201 && resp.StatusCode != 202 {
+		logger.Errorf("Error %s\n", resp.Status)
+		return errors.New(resp.Status)
+	}
+	fmt.Printf("Created bucket %s\n", options.Bucket)
+	return nil
+}
+
+// EnsureContainers creates options.Bucket and its segments container if missing
+//
+// Segments container is created with options.StoragePolicy, or with the policy of
+// options.Bucket if not set.
+func EnsureContainers(token string, server string, options Options) error {
+	segOptions := Options{Bucket: options.Bucket + "_segments", StoragePolicy: options.StoragePolicy, DryRun: options.DryRun}
+	for _, container := range []Options{options, segOptions} {
+		exists, err := ContainerExists(token, server, container.Bucket)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if container.StoragePolicy == "" && container.Bucket == segOptions.Bucket {
+			info, err := Show(token, server, Options{Bucket: options.Bucket})
+			if err != nil && !options.DryRun {
+				return err
+			}
+			container.StoragePolicy = info["X-Storage-Policy"]
+		}
+		if err := CreateContainer(token, server, container); err != nil {
+			return fmt.Errorf("failed to create bucket %s: %s", container.Bucket, err)
+		}
+	}
+	return nil
+}
+
+// DeleteContainer deletes container options.Bucket
+//
+// If options.Recursive is set, container objects and their segments are deleted first,
+// as well as the segments container
+func DeleteContainer(token string, server string, options Options) error {
+	containers := []string{options.Bucket}
+	if options.Recursive {
+		options.Prefix = ""
+		options.Filter = Filter{}
+		options.Match = ""
+		options.Regex = nil
+		if err := DeleteWithPrefix(token, server, options); err != nil {
+			return err
+		}
+		segments := options.Bucket + "_segments"
+		exists, err := ContainerExists(token, server, segments)
+		if err != nil {
+			return err
+		}
+		if exists {
+			// remaining segments are orphans
+			segOptions := options
+			segOptions.Bucket = segments
+			var paths []string
+			var size int64
+			for _, file := range List(token, server, segOptions) {
+				paths = append(paths, objectPath(segments, file.Name))
+				size += int64(file.Bytes)
+			}
+			// deletion of their objects is already confirmed
+			if _, err := deleteObjects(token, server, options, 0, paths, size); err != nil {
+				return err
+			}
+			containers = append(containers, segments)
+		}
+	}
+	client := &http.Client{}
+	for _, container := range containers {
+		if options.DryRun {
+			fmt.Printf("Would delete bucket %s\n", container)
+			continue
+		}
+		url := []string{server, container}
+		logger.Debugf("Call %s\n", strings.Join(url, "/"))
+		req, _ := http.NewRequest("DELETE", strings.Join(url, "/"), nil)
+		req.Header.Add("X-Auth-Token", token)
+		resp, err := client.Do(req)
+		if err != nil {
+			logger.Errorf("Failed to contact server %s\n", server)
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == 409 {
+			return fmt.Errorf("bucket %s is not empty", container)
+		}
+		if resp.StatusCode != 204 {
+			logger.Errorf("Error %s\n", resp.Status)
+			return errors.New(resp.Status)
+		}
+		fmt.Printf("Deleted bucket %s\n", container)
+	}
+	return nil
+}
+
+// keepSegments checks if segments of overwritten or deleted manifests must be kept,
+// because of options.LeaveSegments or because container keeps versions referencing them
+func keepSegments(token string, server string, options Options) bool {
+	if options.LeaveSegments {
+		return true
+	}
+	if isVersioned(token, server, options.Bucket) {
+		printf(options, "Bucket %s is versioned, segments are kept\n", options.Bucket)
+		return true
+	}
+	return false
+}
+
+// DeleteWithPrefix deletes all files matching prefix, and their segments
+//
+// Objects are deleted in batches with bulk delete if supported by cluster
+func DeleteWithPrefix(token string, server string, options Options) error {
 	if options.Prefix == "**/*" {
 		fmt.Println("Warning: deleting all files")
 		options.Prefix = ""
 	}
-	files := List(token, server, options)
-	for _, file := range files {
-		options.File = file.Name
-		DeleteWithSegments(token, server, options)
+	options.LeaveSegments = keepSegments(token, server, options)
+	files := ListMatching(token, server, options)
+	// segments of manifests are looked up by options.ObjectThreads concurrent workers
+	filePaths := make([][]string, len(files))
+	fileSizes := make([]int64, len(files))
+	var tasks []ObjectTask
+	for i := range files {
+		i := i
+		tasks = append(tasks, func(out io.Writer) error {
+			taskOptions := options
+			taskOptions.Output = out
+			filePaths[i], fileSizes[i] = objectPaths(token, server, taskOptions, files[i])
+			return nil
+		})
+	}
+	if err := RunObjects(options.ObjectThreads, tasks); err != nil {
+		return err
 	}
+	var paths []string
+	var size int64
+	for i := range files {
+		paths = append(paths, filePaths[i]...)
+		size += fileSizes[i]
+	}
+	_, err := deleteObjects(token, server, options, len(files), paths, size)
+	return err
 }
 
 // DeleteWithSegments deletes a file and segments if any from swift
-func DeleteWithSegments(token string, server string, options Options) {
-	if options.ObjectName == "" {
-		options.ObjectName = options.File
-	}
-	manifest := Head(token, server, options)
-	bucket := options.Bucket
-	prefix := options.Prefix
-	file := options.File
-	if manifest != "" && options.LeaveSegments == false {
-		options.Prefix = strings.Replace(manifest, options.Bucket+"_segments/", "", -1)
-		options.Bucket = options.Bucket + "_segments"
-		oldFiles := List(token, server, options)
-		logger.Debugf("Delete old segment files")
-		for _, file := range oldFiles {
-			options.File = file.Name
-			fmt.Printf("Delete segment %s, size: %d, last: %s\n", file.Name, file.Bytes, file.LastModified)
-			DeleteFile(token, server, options)
-		}
-	}
-	options.Bucket = bucket
-	options.Prefix = prefix
-	options.File = file
-	DeleteFile(token, server, options)
+func DeleteWithSegments(token string, server string, options Options) error {
+	options.LeaveSegments = keepSegments(token, server, options)
+	paths, size := objectPaths(token, server, options, SwiftFile{Name: options.File})
+	// a single object is never confirmed, whatever its number of segments
+	_, err := deleteObjects(token, server, options, 1, paths, size)
+	return err
 }
 
 // Delete deletes a file from swift
@@ -357,99 +1019,225 @@ func DeleteFile(token string, server string, options Options) bool {
 }
 
 // DownloadWithPrefix downloads all files matching prefix from swift
-func DownloadWithPrefix(token string, server string, options Options) {
-	files := List(token, server, options)
-	objectName := options.ObjectName
-	for i := range files {
-		options.File = files[i].Name
-		if options.ObjectName != "" {
-			localPath := []string{objectName, options.File}
-			options.ObjectName = strings.Join(localPath, "/")
+//
+// Files are downloaded by options.ObjectThreads concurrent workers.
+// If options.ObjectName is "-", files are written one after the other to stdout
+func DownloadWithPrefix(token string, server string, options Options) error {
+	files := ListMatching(token, server, options)
+	if options.DryRun {
+		var size uint64
+		for _, file := range files {
+			fmt.Printf("Would download %s, %d bytes\n", file.Name, file.Bytes)
+			size += file.Bytes
 		}
-		fmt.Printf("Download %s => %s\n", options.File, options.ObjectName)
-		Download(token, server, options)
+		fmt.Printf("Would download %d files, %d bytes\n", len(files), size)
+		return nil
 	}
+	threads := options.ObjectThreads
+	if options.ObjectName == "-" {
+		// contents would be mixed on stdout
+		threads = 1
+	}
+	var tasks []ObjectTask
+	for _, file := range files {
+		fileOptions := options
+		fileOptions.File = file.Name
+		tasks = append(tasks, func(out io.Writer) error {
+			fileOptions.Output = out
+			if fileOptions.ObjectName == "-" {
+				fmt.Fprintf(os.Stderr, "Download %s => stdout\n", fileOptions.File)
+			} else {
+				if fileOptions.ObjectName != "" {
+					localPath := []string{options.ObjectName, fileOptions.File}
+					fileOptions.ObjectName = strings.Join(localPath, "/")
+				}
+				printf(fileOptions, "Download %s => %s\n", fileOptions.File, fileOptions.ObjectName)
+			}
+			if !Download(token, server, fileOptions) {
+				return fmt.Errorf("failed to download %s", fileOptions.File)
+			}
+			return nil
+		})
+	}
+	return RunObjects(threads, tasks)
 }
 
 // Download downloads a file from swift
+//
+// If options.ObjectName is "-", file is written to stdout
 func Download(token string, server string, options Options) bool {
 	client := &http.Client{}
 	if options.ObjectName == "" {
 		options.ObjectName = options.File
 	}
+	if options.ObjectName == "-" {
+		// content goes to stdout, keep messages out of it
+		options.Output = os.Stderr
+	}
+	if options.DryRun {
+		meta, err := Show(token, server, options)
+		if err != nil {
+			printf(options, "Cannot download %s: %s\n", options.File, err)
+			return false
+		}
+		printf(options, "Would download %s => %s, %s bytes\n", options.File, options.ObjectName, meta["Content-Length"])
+		return true
+	}
 	url := []string{server, options.Bucket, options.File}
-	logger.Debugf("Call %s\n", strings.Join(url, "/"))
-	req, _ := http.NewRequest("GET", strings.Join(url, "/"), nil)
+	reqURL := strings.Join(url, "/")
+	query := []string{}
+	if q := versionQuery(options); q != "" {
+		query = append(query, q)
+	}
+	restoreLinks := options.Symlinks == SymlinksStore && options.ObjectName != "-"
+	if restoreLinks {
+		query = append(query, "symlink=get")
+	}
+	if len(query) > 0 {
+		reqURL = reqURL + "?" + strings.Join(query, "&")
+	}
+	logger.Debugf("Call %s\n", reqURL)
+	req, _ := http.NewRequest("GET", reqURL, nil)
 	req.Header.Add("X-Auth-Token", token)
 	req.Header.Add("Accept", "application/json")
 	resp, err := client.Do(req)
 	if err != nil {
-		logger.Errorf("Failed to contact server %s\n", server)
+		printf(options, "Failed to contact server %s\n", server)
 		return false
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 && resp.StatusCode != 204 {
-		logger.Errorf("Error: %s\n", resp.Status)
+		printf(options, "Error: %s\n", resp.Status)
 		return false
 	}
+	if options.ObjectName == "-" {
+		if _, err = io.Copy(os.Stdout, resp.Body); err != nil {
+			printf(options, "Error: %s\n", err)
+			return false
+		}
+		return true
+	}
 	if resp.StatusCode == 204 {
-		fmt.Printf("No content\n")
+		printf(options, "No content\n")
+		return true
+	}
+	if target := resp.Header.Get("X-Symlink-Target"); restoreLinks && target != "" {
+		err := restoreSymlink(options, target)
+		if err == nil {
+			return true
+		}
+		printf(options, "Cannot restore symlink %s: %s, downloading its target\n", options.File, err)
+		options.Symlinks = ""
+		return Download(token, server, options)
+	}
+	if resp.Header.Get("Content-Type") == DirectoryContentType {
+		// directory marker, recreate empty directory
+		if mkerr := os.MkdirAll(options.ObjectName, 0755); mkerr != nil {
+			printf(options, "Error: %s\n", mkerr)
+			return false
+		}
 		return true
 	}
 	mkerr := os.MkdirAll(filepath.Dir(options.ObjectName), 0755)
 	if mkerr != nil {
-		logger.Errorf("Error: %s", mkerr)
+		printf(options, "Error: %s\n", mkerr)
 		return false
 	}
 	out, err := os.Create(options.ObjectName)
 	if err != nil {
-		logger.Errorf("Error: %s", err)
+		printf(options, "Error: %s\n", err)
+		return false
+	}
+	if _, err = io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		printf(options, "Error: %s\n", err)
+		return false
+	}
+	if err = out.Close(); err != nil {
+		printf(options, "Error: %s\n", err)
 		return false
 	}
-	defer out.Close()
-	_, err = io.Copy(out, resp.Body)
 	return true
 }
 
-// List list swift content
-func List(token string, server string, options Options) []SwiftFile {
-	var files []SwiftFile
+// listPage gets one page of a json listing of account or container url, matching options.Prefix,
+// starting after marker
+//
+// Returns false when listing is not available (error or no content)
+func listPage(token string, server string, options Options, url string, marker string, page interface{}) bool {
 	client := &http.Client{}
-	url := []string{server, options.Bucket}
-	logger.Debugf("Call %s\n", strings.Join(url, "/"))
-	logger.Debugf("Prefix: %s", options.Prefix)
-	req, _ := http.NewRequest("GET", strings.Join(url, "/"), nil)
+	logger.Debugf("Call %s\n", url)
+	logger.Debugf("Prefix: %s, marker: %s", options.Prefix, marker)
+	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Add("X-Auth-Token", token)
 	req.Header.Add("Accept", "application/json")
+	q := req.URL.Query()
+	q.Add("format", "json")
 	if options.Prefix != "" {
-		q := req.URL.Query()
 		q.Add("prefix", options.Prefix)
-		req.URL.RawQuery = q.Encode()
 	}
+	if marker != "" {
+		q.Add("marker", marker)
+	}
+	req.URL.RawQuery = q.Encode()
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Errorf("Failed to contact server %s\n", server)
-		return files
+		return false
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 && resp.StatusCode != 204 {
 		logger.Errorf("Error: %s\n", resp.Status)
-		return files
+		return false
 	}
 	if resp.StatusCode == 204 {
-		fmt.Printf("No content\n")
-		return files
+		if marker == "" {
+			printf(options, "No content\n")
+		}
+		return false
 	}
 	body, errBody := ioutil.ReadAll(resp.Body)
 	if errBody != nil {
 		logger.Errorf("Failed to read server response\n")
-		return files
+		return false
 	}
-	jerr := json.Unmarshal(body, &files)
+	jerr := json.Unmarshal(body, page)
 	if jerr != nil {
 		logger.Errorf("Failed to decode answer\n")
-		return files
+		return false
 	}
-	return files
+	return true
+}
 
+// List list swift content
+//
+// Listing is paginated, all pages are fetched
+func List(token string, server string, options Options) []SwiftFile {
+	var files []SwiftFile
+	url := []string{server, options.Bucket}
+	marker := ""
+	for {
+		var page []SwiftFile
+		if !listPage(token, server, options, strings.Join(url, "/"), marker, &page) || len(page) == 0 {
+			return files
+		}
+		files = append(files, page...)
+		marker = page[len(page)-1].Name
+	}
+}
+
+// ListContainers lists account containers matching options.Prefix
+//
+// Listing is paginated, all pages are fetched
+func ListContainers(token string, server string, options Options) []SwiftContainer {
+	var containers []SwiftContainer
+	marker := ""
+	for {
+		var page []SwiftContainer
+		if !listPage(token, server, options, server, marker, &page) || len(page) == 0 {
+			return containers
+		}
+		containers = append(containers, page...)
+		marker = page[len(page)-1].Name
+	}
 }
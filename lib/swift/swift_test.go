@@ -2,8 +2,12 @@ package swift_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	swift "github.com/osallou/herodote-file/lib/swift"
@@ -27,7 +31,7 @@ func swiftSimulator(res http.ResponseWriter, req *http.Request) {
 
 	if req.Method == "HEAD" {
 		fmt.Printf("Requested url %s\n", req.RequestURI)
-		if req.RequestURI == "/project/withManifest" {
+		if req.URL.Path == "/project/withManifest" && req.URL.Query().Get("symlink") == "get" {
 			res.Header().Set("X-Object-Manifest", "/project_segments/withManifest")
 		}
 	} else if req.Method == "GET" {
@@ -106,3 +110,364 @@ func TestSwiftStat(t *testing.T) {
 	}
 
 }
+
+func TestSwiftUploadStdin(t *testing.T) {
+	puts := make(map[string]int)
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == "PUT" {
+			body, _ := ioutil.ReadAll(req.Body)
+			puts[req.URL.Path] = len(body)
+			res.WriteHeader(201)
+			return
+		}
+		res.WriteHeader(404)
+	}))
+	defer func() { testServer.Close() }()
+
+	r, w, _ := os.Pipe()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	go func() {
+		w.Write([]byte("0123456789"))
+		w.Close()
+	}()
+
+	options := swift.Options{Bucket: "project", File: "-", ObjectName: "stream.tar", Size: 4}
+	if !swift.Upload("123", testServer.URL, options) {
+		t.Error("upload failed")
+	}
+	// 3 segments + manifest
+	if len(puts) != 4 {
+		t.Errorf("expected 4 PUT requests, got %d", len(puts))
+	}
+	if size, ok := puts["/project/stream.tar"]; !ok || size != 0 {
+		t.Error("manifest not uploaded")
+	}
+
+	// empty segments would be uploaded forever
+	options.Size = 0
+	if swift.Upload("123", testServer.URL, options) {
+		t.Error("upload with segment size 0 should be refused")
+	}
+}
+
+func TestSwiftUploadEmptyFile(t *testing.T) {
+	puts := make(map[string]string)
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == "PUT" {
+			puts[req.URL.Path] = req.Header.Get("Content-Type")
+			res.WriteHeader(201)
+			return
+		}
+		res.WriteHeader(404)
+	}))
+	defer func() { testServer.Close() }()
+
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	empty := filepath.Join(dir, "_SUCCESS")
+	ioutil.WriteFile(empty, []byte{}, 0644)
+
+	options := swift.Options{Bucket: "project", File: empty, ObjectName: "_SUCCESS", Size: 10}
+	if !swift.Upload("123", testServer.URL, options) {
+		t.Error("empty file upload failed")
+	}
+	if _, ok := puts["/project/_SUCCESS"]; !ok {
+		t.Error("empty file not uploaded")
+	}
+	options.File = filepath.Join(dir, "missing")
+	if swift.Upload("123", testServer.URL, options) {
+		t.Error("missing file should fail")
+	}
+
+	options = swift.Options{Bucket: "project", ObjectName: "emptydir/"}
+	if !swift.UploadDirMarker("123", testServer.URL, options) {
+		t.Error("directory marker upload failed")
+	}
+	if puts["/project/emptydir"] != swift.DirectoryContentType {
+		t.Error("directory marker has wrong content type")
+	}
+}
+
+func TestSwiftDetectContentType(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	jsonFile := filepath.Join(dir, "data.json")
+	ioutil.WriteFile(jsonFile, []byte("{}"), 0644)
+	if ctype := swift.DetectContentType(jsonFile); ctype != "application/json" {
+		t.Errorf("wrong content type from extension: %s", ctype)
+	}
+	noExt := filepath.Join(dir, "index")
+	ioutil.WriteFile(noExt, []byte("<html><body>hello</body></html>"), 0644)
+	if ctype := swift.DetectContentType(noExt); !strings.HasPrefix(ctype, "text/html") {
+		t.Errorf("wrong sniffed content type: %s", ctype)
+	}
+}
+
+func TestSwiftParseHeader(t *testing.T) {
+	name, value, err := swift.ParseHeader("X-Object-Meta-Source: http://example.com:8080/data")
+	if err != nil || name != "X-Object-Meta-Source" || value != "http://example.com:8080/data" {
+		t.Errorf("wrong header parsing: %s, %s, %v", name, value, err)
+	}
+	if _, _, err = swift.ParseHeader("no separator"); err == nil {
+		t.Error("header without separator should fail")
+	}
+	if _, _, err = swift.ParseHeader("Bad Name: value"); err == nil {
+		t.Error("header name with space should fail")
+	}
+}
+
+func TestSwiftPost(t *testing.T) {
+	var posted http.Header
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == "HEAD" {
+			res.Header().Set("X-Object-Meta-Keep", "yes")
+			res.Header().Set("X-Object-Meta-Old", "old")
+			res.WriteHeader(200)
+			return
+		}
+		if req.Method == "POST" {
+			posted = req.Header
+			res.WriteHeader(202)
+			return
+		}
+		res.WriteHeader(405)
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "project", File: "myfile"}
+	options.Meta = map[string]string{"new": "value"}
+	options.RemoveMeta = []string{"old"}
+	if err := swift.Post("123", testServer.URL, options); err != nil {
+		t.Errorf("post failed: %s", err)
+	}
+	if posted.Get("X-Object-Meta-Keep") != "yes" || posted.Get("X-Object-Meta-New") != "value" {
+		t.Error("object meta data not sent")
+	}
+	if posted.Get("X-Object-Meta-Old") != "" {
+		t.Error("removed meta data should not be sent")
+	}
+
+	options.File = ""
+	if err := swift.Post("123", testServer.URL, options); err != nil {
+		t.Errorf("post failed: %s", err)
+	}
+	if posted.Get("X-Remove-Container-Meta-Old") == "" || posted.Get("X-Container-Meta-New") != "value" {
+		t.Error("container meta data not sent")
+	}
+}
+
+func TestSwiftEnsureContainers(t *testing.T) {
+	containers := map[string]string{"/project": ""}
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "HEAD":
+			policy, ok := containers[strings.TrimSuffix(req.URL.Path, "/")]
+			if !ok {
+				res.WriteHeader(404)
+				return
+			}
+			res.Header().Set("X-Storage-Policy", policy)
+			res.WriteHeader(204)
+		case "PUT":
+			containers[req.URL.Path] = req.Header.Get("X-Storage-Policy")
+			res.WriteHeader(201)
+		default:
+			res.WriteHeader(405)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "project", StoragePolicy: "ec"}
+	if err := swift.EnsureContainers("123", testServer.URL, options); err != nil {
+		t.Errorf("failed to create containers: %s", err)
+	}
+	if policy, ok := containers["/project_segments"]; !ok || policy != "ec" {
+		t.Error("segments container not created")
+	}
+	if containers["/project"] != "" {
+		t.Error("existing container should not be created again")
+	}
+
+	// segments container inherits policy of existing container
+	containers["/gold"] = "gold"
+	if err := swift.EnsureContainers("123", testServer.URL, swift.Options{Bucket: "gold"}); err != nil {
+		t.Errorf("failed to create containers: %s", err)
+	}
+	if containers["/gold_segments"] != "gold" {
+		t.Errorf("segments container policy not inherited: %q", containers["/gold_segments"])
+	}
+}
+
+func TestSwiftListContainers(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" || req.URL.Query().Get("prefix") != "pro" {
+			res.WriteHeader(404)
+			return
+		}
+		res.WriteHeader(200)
+		switch req.URL.Query().Get("marker") {
+		case "":
+			res.Write([]byte(`[{"name": "project", "count": 2, "bytes": 10, "last_modified": "2019-01-01T00:00:00.000000"}]`))
+		case "project":
+			res.Write([]byte(`[{"name": "project_segments", "count": 3, "bytes": 20, "last_modified": "2019-01-01T00:00:00.000000"}]`))
+		default:
+			res.Write([]byte(`[]`))
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Prefix: "pro"}
+	containers := swift.ListContainers("123", testServer.URL+"/", options)
+	if len(containers) != 2 {
+		t.Fatalf("expected 2 containers, got %d", len(containers))
+	}
+	if containers[1].Name != "project_segments" || containers[1].Count != 3 || containers[1].Bytes != 20 {
+		t.Errorf("wrong container info: %+v", containers[1])
+	}
+}
+
+func TestSwiftPostExpiration(t *testing.T) {
+	posted := make(map[string]http.Header)
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "HEAD":
+			res.Header().Set("X-Object-Manifest", "project_segments/large/1/2")
+			res.Header().Set("X-Delete-At", "1500000000")
+			res.Header().Set("X-Object-Meta-Owner", "me")
+			res.WriteHeader(200)
+		case "GET":
+			res.WriteHeader(200)
+			if req.URL.Query().Get("marker") != "" {
+				res.Write([]byte(`[]`))
+				return
+			}
+			res.Write([]byte(`[{"name": "large/1/2/0000000000", "bytes": 1}]`))
+		case "POST":
+			posted[req.URL.Path] = req.Header
+			res.WriteHeader(202)
+		default:
+			res.WriteHeader(405)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "project", File: "large", DeleteAt: 1600000000}
+	if err := swift.Post("123", testServer.URL, options); err != nil {
+		t.Errorf("post failed: %s", err)
+	}
+	if posted["/project/large"].Get("X-Delete-At") != "1600000000" {
+		t.Error("manifest expiration not updated")
+	}
+	if posted["/project_segments/large/1/2/0000000000"].Get("X-Delete-At") != "1600000000" {
+		t.Error("segment expiration not updated")
+	}
+	if posted["/project_segments/large/1/2/0000000000"].Get("X-Object-Meta-Owner") != "me" {
+		t.Error("segment meta data not kept")
+	}
+}
+
+func TestSwiftUploadSegmentsExpiration(t *testing.T) {
+	expirations := make(map[string]string)
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == "PUT" {
+			if req.Header.Get("X-Delete-After") != "" {
+				expirations[req.URL.Path] = "relative"
+			} else {
+				expirations[req.URL.Path] = req.Header.Get("X-Delete-At")
+			}
+			res.WriteHeader(201)
+			return
+		}
+		res.WriteHeader(404)
+	}))
+	defer func() { testServer.Close() }()
+
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	localPath := filepath.Join(dir, "large")
+	ioutil.WriteFile(localPath, []byte("0123456789012345678901234"), 0644)
+
+	options := swift.Options{Bucket: "project", File: localPath, ObjectName: "large", Size: 10, Headers: map[string]string{"X-Delete-After": "86400"}}
+	if !swift.Upload("123", testServer.URL, options) {
+		t.Fatal("upload failed")
+	}
+	// 3 segments + manifest
+	if len(expirations) != 4 {
+		t.Fatalf("wrong uploads: %v", expirations)
+	}
+	deleteAt := expirations["/project/large"]
+	if deleteAt == "" || deleteAt == "relative" {
+		t.Fatalf("manifest expiration not set: %v", expirations)
+	}
+	for path, expiration := range expirations {
+		if expiration != deleteAt {
+			t.Errorf("object %s does not expire with manifest: %s", path, expiration)
+		}
+	}
+}
+
+func TestSwiftDownloadTruncated(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		// connection closed before announced length is sent
+		res.Header().Set("Content-Length", "100")
+		res.WriteHeader(200)
+		res.Write([]byte("partial"))
+	}))
+	defer func() { testServer.Close() }()
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+
+	var output strings.Builder
+	options := swift.Options{Bucket: "project", File: "data/a", ObjectName: filepath.Join(dir, "a"), Output: &output}
+	if swift.Download("123", testServer.URL, options) {
+		t.Errorf("truncated download succeeded")
+	}
+	if !strings.Contains(output.String(), "Error: unexpected EOF") {
+		t.Errorf("copy error not reported: %s", output.String())
+	}
+}
+
+func TestSwiftDeleteContainer(t *testing.T) {
+	objects := map[string]string{
+		"/project/a":               "",
+		"/project/big":             "project_segments/big/",
+		"/project_segments/big/01": "",
+	}
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			if req.URL.Path == "/info" || req.URL.Query().Get("marker") != "" {
+				res.WriteHeader(404)
+				return
+			}
+			var names []string
+			for object := range objects {
+				if strings.HasPrefix(object, req.URL.Path+"/"+req.URL.Query().Get("prefix")) {
+					names = append(names, fmt.Sprintf(`{"name": "%s"}`, strings.TrimPrefix(object, req.URL.Path+"/")))
+				}
+			}
+			res.WriteHeader(200)
+			res.Write([]byte("[" + strings.Join(names, ",") + "]"))
+		case "HEAD":
+			res.Header().Set("X-Object-Manifest", objects[req.URL.Path])
+			res.WriteHeader(200)
+		case "DELETE":
+			delete(objects, req.URL.Path)
+			res.WriteHeader(204)
+		default:
+			res.WriteHeader(405)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	// a selection of objects is ignored, all objects are deleted with their segments
+	options := swift.Options{Bucket: "project", Recursive: true, Match: "a*"}
+	if err := swift.DeleteContainer("123", testServer.URL, options); err != nil {
+		t.Errorf("bucket deletion failed: %s", err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("objects not deleted: %v", objects)
+	}
+}
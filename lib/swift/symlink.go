@@ -0,0 +1,230 @@
+package swift
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Symlinks policies of directory uploads
+const (
+	// SymlinksFollow uploads targets of symlinks, and content of symlinked directories
+	SymlinksFollow = "follow"
+	// SymlinksSkip ignores symlinks
+	SymlinksSkip = "skip"
+	// SymlinksStore stores symlinks as swift symlink objects, restored as symlinks on download
+	SymlinksStore = "store"
+)
+
+// SymlinkContentType is the content type of swift symlink objects
+const SymlinkContentType = "application/symlink"
+
+// WalkLinks walks dir as WalkFiltered, handling symlinks according to symlinks policy
+//
+// With default policy, symlinked files are walked as their target and symlinked directories are skipped.
+// SymlinksFollow also walks content of symlinked directories, skipping links to a directory being walked,
+// paths are reported under the symlink path. SymlinksStore reports symlinks themselves, with their
+// os.Lstat info, SymlinksSkip ignores them. Skipped symlinks are reported to out.
+func WalkLinks(dir string, filter Filter, symlinks string, out io.Writer, walkFn filepath.WalkFunc) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return walkFn(dir, nil, err)
+	}
+	return walkLinks(realDir, dir, "", filter, symlinks, nil, out, walkFn)
+}
+
+// walkLinks walks realDir, which contains no symlink, reporting paths under dir
+//
+// rel is the slash separated path of dir relative to walked root, followed are the real parent
+// directories of followed symlinks leading to dir.
+func walkLinks(realDir string, dir string, rel string, filter Filter, symlinks string, followed []string, out io.Writer, walkFn filepath.WalkFunc) error {
+	return filepath.Walk(realDir, func(realPath string, info os.FileInfo, err error) error {
+		localPath := dir
+		name := rel
+		if sub, relErr := filepath.Rel(realDir, realPath); relErr == nil && sub != "." {
+			localPath = filepath.Join(dir, sub)
+			name = path.Join(rel, filepath.ToSlash(sub))
+		}
+		if err != nil || name == "" {
+			return walkFn(localPath, info, err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return walkLink(realPath, localPath, name, info, filter, symlinks, followed, out, walkFn)
+		}
+		if realPath == realDir {
+			// root of a followed directory, already filtered
+			return walkFn(localPath, info, err)
+		}
+		if info.IsDir() {
+			if filter.SkipDir(name) {
+				logger.Debugf("Skip directory %s, filtered", localPath)
+				return filepath.SkipDir
+			}
+		} else if !filter.Match(name) {
+			logger.Debugf("Skip %s, filtered", localPath)
+			return nil
+		}
+		return walkFn(localPath, info, err)
+	})
+}
+
+// walkLink applies symlinks policy to symlink realPath, reported as localPath
+func walkLink(realPath string, localPath string, name string, info os.FileInfo, filter Filter, symlinks string, followed []string, out io.Writer, walkFn filepath.WalkFunc) error {
+	switch symlinks {
+	case SymlinksSkip:
+		fmt.Fprintf(out, "Skip symlink %s\n", localPath)
+		return nil
+	case SymlinksStore:
+		if !filter.Match(name) {
+			logger.Debugf("Skip %s, filtered", localPath)
+			return nil
+		}
+		return walkFn(localPath, info, nil)
+	}
+	target, err := os.Stat(realPath)
+	if err != nil {
+		fmt.Fprintf(out, "Skip broken symlink %s\n", localPath)
+		return nil
+	}
+	if !target.IsDir() {
+		if !filter.Match(name) {
+			logger.Debugf("Skip %s, filtered", localPath)
+			return nil
+		}
+		return walkFn(localPath, target, nil)
+	}
+	if symlinks != SymlinksFollow {
+		fmt.Fprintf(out, "Skip symlinked directory %s, use follow-symlinks to upload its content\n", localPath)
+		return nil
+	}
+	if filter.SkipDir(name) {
+		logger.Debugf("Skip directory %s, filtered", localPath)
+		return nil
+	}
+	realTarget, err := filepath.EvalSymlinks(realPath)
+	if err != nil {
+		fmt.Fprintf(out, "Skip broken symlink %s\n", localPath)
+		return nil
+	}
+	// a link to a directory containing the link, or a link followed to get here, loops
+	parents := append([]string{filepath.Dir(realPath)}, followed...)
+	for _, parent := range parents {
+		if parent == realTarget || strings.HasPrefix(parent, realTarget+string(filepath.Separator)) {
+			fmt.Fprintf(out, "Skip symlink %s, loop to %s\n", localPath, realTarget)
+			return nil
+		}
+	}
+	return walkLinks(realTarget, localPath, name, filter, symlinks, parents, out, walkFn)
+}
+
+// symlinkTarget returns the object name targeted by a symlink object objectName
+// to local symlink target link, which must be relative and stay in bucket
+func symlinkTarget(objectName string, link string) (string, error) {
+	if filepath.IsAbs(link) {
+		return "", fmt.Errorf("absolute target %s", link)
+	}
+	target := path.Join(path.Dir(objectName), filepath.ToSlash(link))
+	if target == "." || target == ".." || strings.HasPrefix(target, "../") {
+		return "", fmt.Errorf("target %s is outside of bucket", link)
+	}
+	return target, nil
+}
+
+// UploadSymlink creates a swift symlink object options.ObjectName to the object
+// matching target of local symlink options.File
+func UploadSymlink(token string, server string, options Options) bool {
+	if options.ObjectName == "" {
+		options.ObjectName = options.File
+	}
+	options.ObjectName = strings.TrimPrefix(options.ObjectName, "/")
+	link, err := os.Readlink(options.File)
+	if err != nil {
+		printf(options, "Failed to read symlink %s: %s\n", options.File, err)
+		return false
+	}
+	target, err := symlinkTarget(options.ObjectName, link)
+	if err != nil {
+		printf(options, "Skip symlink %s: %s\n", options.File, err)
+		return false
+	}
+	if options.DryRun {
+		printf(options, "Would create symlink %s => %s\n", options.ObjectName, target)
+		return true
+	}
+	printf(options, "Create symlink: %s => %s\n", options.ObjectName, target)
+	client := &http.Client{}
+	url := []string{server, options.Bucket, options.ObjectName}
+	logger.Debugf("Call %s\n", strings.Join(url, "/"))
+	req, _ := http.NewRequest("PUT", strings.Join(url, "/"), bytes.NewReader([]byte{}))
+	req.Header.Add("X-Auth-Token", token)
+	req.Header.Add("X-Symlink-Target", strings.TrimPrefix(objectPath(options.Bucket, target), "/"))
+	req.Header.Add("Content-Type", SymlinkContentType)
+	for m := range options.Meta {
+		req.Header.Add("X-Object-Meta-"+m, options.Meta[m])
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		printf(options, "Failed to contact server %s\n", server)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 201 {
+		printf(options, "Failed to create symlink: %s\n", resp.Status)
+		return false
+	}
+	return true
+}
+
+// restoreSymlink creates local symlink options.ObjectName for symlink object options.File
+// to target, a container/object header value
+//
+// Local path must mirror object name under a download directory, and target must be
+// in same bucket and resolve in download directory.
+func restoreSymlink(options Options, target string) error {
+	target, err := neturl.PathUnescape(target)
+	if err != nil {
+		return err
+	}
+	parts := strings.SplitN(target, "/", 2)
+	if len(parts) != 2 || parts[0] != options.Bucket {
+		return fmt.Errorf("target %s is in another bucket", target)
+	}
+	name := path.Clean(strings.TrimPrefix(options.File, "/"))
+	targetName := path.Clean(strings.TrimPrefix(parts[1], "/"))
+	for _, p := range []string{name, targetName} {
+		if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+			return fmt.Errorf("target %s is outside of download directory", target)
+		}
+	}
+	localPath := filepath.Clean(options.ObjectName)
+	if localPath != filepath.FromSlash(name) && !strings.HasSuffix(localPath, string(filepath.Separator)+filepath.FromSlash(name)) {
+		return fmt.Errorf("%s is not downloaded under its object name", options.File)
+	}
+	root := strings.TrimSuffix(localPath, filepath.FromSlash(name))
+	link, err := filepath.Rel(filepath.FromSlash(path.Dir(name)), filepath.FromSlash(targetName))
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.Rel(filepath.Clean(root+"."), filepath.Join(filepath.Dir(localPath), link))
+	if err != nil || resolved == ".." || strings.HasPrefix(resolved, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("target %s is outside of download directory", target)
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(localPath); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", localPath)
+		}
+		if err := os.Remove(localPath); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(link, localPath)
+}
@@ -0,0 +1,140 @@
+package swift_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+// symlinkTree creates a directory with a symlinked file, a symlinked directory and a loop
+func symlinkTree(t *testing.T) string {
+	dir, _ := ioutil.TempDir("", "hero")
+	os.MkdirAll(filepath.Join(dir, "data", "sub"), 0755)
+	os.MkdirAll(filepath.Join(dir, "other"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "data", "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "other", "b.txt"), []byte("b"), 0644)
+	for link, target := range map[string]string{
+		"data/link.txt":    "a.txt",
+		"data/other":       "../other",
+		"data/sub/loop":    "..",
+		"other/back":       "../data",
+		"data/broken.link": "missing",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(link))); err != nil {
+			t.Skipf("symlinks not supported: %s", err)
+		}
+	}
+	return dir
+}
+
+func walkedNames(t *testing.T, dir string, symlinks string) string {
+	var walked []string
+	err := swift.WalkLinks(filepath.Join(dir, "data"), swift.Filter{}, symlinks, ioutil.Discard, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			walked = append(walked, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Errorf("walk failed: %s", err)
+	}
+	sort.Strings(walked)
+	return strings.Join(walked, ",")
+}
+
+func TestSwiftWalkLinks(t *testing.T) {
+	dir := symlinkTree(t)
+	defer os.RemoveAll(dir)
+
+	walked := map[string]string{
+		"":                  "data/a.txt,data/link.txt",
+		swift.SymlinksSkip:  "data/a.txt",
+		swift.SymlinksStore: "data/a.txt,data/broken.link,data/link.txt,data/other,data/sub/loop",
+		// loops through data/sub/loop and data/other/back are not followed
+		swift.SymlinksFollow: "data/a.txt,data/link.txt,data/other/b.txt",
+	}
+	for symlinks, expected := range walked {
+		if names := walkedNames(t, dir, symlinks); names != expected {
+			t.Errorf("wrong walked files with policy %s: %s", symlinks, names)
+		}
+	}
+}
+
+func TestSwiftUploadSymlink(t *testing.T) {
+	targets := make(map[string]string)
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "PUT" || req.Header.Get("Content-Type") != swift.SymlinkContentType {
+			res.WriteHeader(400)
+			return
+		}
+		targets[req.URL.Path] = req.Header.Get("X-Symlink-Target")
+		res.WriteHeader(201)
+	}))
+	defer func() { testServer.Close() }()
+	dir := symlinkTree(t)
+	defer os.RemoveAll(dir)
+
+	options := swift.Options{Bucket: "project", File: filepath.Join(dir, "data", "other"), ObjectName: "backup/data/other"}
+	if !swift.UploadSymlink("123", testServer.URL, options) || targets["/project/backup/data/other"] != "project/backup/other" {
+		t.Errorf("wrong symlink target: %v", targets)
+	}
+	options = swift.Options{Bucket: "project", File: filepath.Join(dir, "data", "other"), ObjectName: "other"}
+	if swift.UploadSymlink("123", testServer.URL, options) {
+		t.Errorf("symlink to target outside of bucket created")
+	}
+}
+
+func TestSwiftDownloadSymlink(t *testing.T) {
+	target := "project/data/my%20file.txt"
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("symlink") == "get" {
+			res.Header().Set("X-Symlink-Target", target)
+			res.Header().Set("Content-Type", swift.SymlinkContentType)
+			res.WriteHeader(200)
+			return
+		}
+		res.WriteHeader(200)
+		res.Write([]byte("target content"))
+	}))
+	defer func() { testServer.Close() }()
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+
+	localPath := filepath.Join(dir, "links", "link")
+	options := swift.Options{Bucket: "project", File: "links/link", ObjectName: localPath, Symlinks: swift.SymlinksStore}
+	if !swift.Download("123", testServer.URL, options) {
+		t.Fatal("download failed")
+	}
+	if link, err := os.Readlink(localPath); err != nil || link != filepath.Join("..", "data", "my file.txt") {
+		t.Errorf("wrong restored symlink: %s, %v", link, err)
+	}
+
+	// target outside of download directory is downloaded, not linked
+	target = "project/../../outside.txt"
+	localPath = filepath.Join(dir, "escape")
+	options = swift.Options{Bucket: "project", File: "escape", ObjectName: localPath, Symlinks: swift.SymlinksStore}
+	if !swift.Download("123", testServer.URL, options) {
+		t.Fatal("download failed")
+	}
+	if info, err := os.Lstat(localPath); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("symlink outside of download directory restored: %v", err)
+	}
+	if content, _ := ioutil.ReadFile(localPath); string(content) != "target content" {
+		t.Errorf("symlink target not downloaded: %s", content)
+	}
+
+	// without store policy, symlink target is downloaded
+	options = swift.Options{Bucket: "project", File: "links/link", ObjectName: filepath.Join(dir, "copy")}
+	swift.Download("123", testServer.URL, options)
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "copy")); string(content) != "target content" {
+		t.Errorf("symlink target not downloaded: %s", content)
+	}
+}
@@ -0,0 +1,464 @@
+package swift
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mtimeMeta is the meta data storing local modification time of synchronized files
+const mtimeMeta = "Mtime"
+
+// SyncResult summarizes a synchronization
+type SyncResult struct {
+	// Transferred lists uploaded or downloaded object names
+	Transferred []string
+	// Bytes is the size of transferred files
+	Bytes int64
+	// Unchanged is the number of files already up to date
+	Unchanged int
+	// Deleted lists objects, or local files, removed from destination
+	Deleted []string
+	// Errors maps object name to failure reason
+	Errors map[string]string
+}
+
+// String returns synchronization summary
+func (result SyncResult) String() string {
+	return fmt.Sprintf("Transferred %d files (%d bytes), %d unchanged, %d deleted, %d failures",
+		len(result.Transferred), result.Bytes, result.Unchanged, len(result.Deleted), len(result.Errors))
+}
+
+// formatMtime formats a modification time as swift clients do, seconds with microseconds
+func formatMtime(t time.Time) string {
+	return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
+}
+
+// parseMtime parses a Mtime meta data value
+func parseMtime(value string) (time.Time, error) {
+	parts := strings.SplitN(value, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nsec := int64(0)
+	if len(parts) == 2 {
+		fraction := (parts[1] + "000000000")[:9]
+		if nsec, err = strconv.ParseInt(fraction, 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+// remoteMtime returns modification time of an object from its Mtime meta data,
+// or its Last-Modified header if not set
+func remoteMtime(meta map[string]string) (time.Time, bool) {
+	if mtime, err := parseMtime(meta["X-Object-Meta-"+mtimeMeta]); err == nil {
+		return mtime, true
+	}
+	if lastModified, err := http.ParseTime(meta["Last-Modified"]); err == nil {
+		return lastModified, true
+	}
+	return time.Time{}, false
+}
+
+func fileMD5(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// syncObjectName returns object name of local relative path rel under prefix
+func syncObjectName(prefix string, rel string) string {
+	if prefix == "" {
+		return rel
+	}
+	return path.Join(prefix, rel)
+}
+
+// syncListing lists objects under options.Prefix, considered as a directory, indexed by name
+//
+// options.Filter is applied to names relative to prefix.
+func syncListing(token string, server string, options Options) map[string]SwiftFile {
+	listOptions := options
+	if listOptions.Prefix != "" && !strings.HasSuffix(listOptions.Prefix, "/") {
+		listOptions.Prefix = listOptions.Prefix + "/"
+	}
+	remote := make(map[string]SwiftFile)
+	for _, file := range List(token, server, listOptions) {
+		if !options.Filter.Match(relativeName(listOptions.Prefix, file.Name)) {
+			logger.Debugf("Skip %s, filtered", file.Name)
+			continue
+		}
+		remote[file.Name] = file
+	}
+	return remote
+}
+
+// localChanged checks if local file differs from remote object
+//
+// Objects of same size are compared with MD5. Large objects are listed with the
+// size and hash of their manifest, so their size and modification time are compared instead.
+func localChanged(token string, server string, options Options, localPath string, info os.FileInfo, remote SwiftFile) (bool, error) {
+	if remote.Bytes != 0 {
+		if remote.Bytes != uint64(info.Size()) {
+			return true, nil
+		}
+		sum, err := fileMD5(localPath)
+		if err != nil {
+			return true, err
+		}
+		return sum != remote.Hash, nil
+	}
+	meta, err := Show(token, server, Options{Bucket: options.Bucket, File: remote.Name})
+	if err != nil {
+		return true, nil
+	}
+	if meta["X-Object-Manifest"] == "" {
+		return info.Size() != 0, nil
+	}
+	if meta["Content-Length"] != strconv.FormatInt(info.Size(), 10) {
+		return true, nil
+	}
+	if mtime := meta["X-Object-Meta-"+mtimeMeta]; mtime != "" {
+		return mtime != formatMtime(info.ModTime()), nil
+	}
+	mtime, ok := remoteMtime(meta)
+	return !ok || mtime.Unix() != info.ModTime().Unix(), nil
+}
+
+// SyncToRemote uploads new and changed files of local directory options.File to options.Bucket
+// under options.Prefix
+//
+// Uploaded objects get the local modification time as Mtime meta data. If options.DeleteExtra
+// is set, objects under prefix with no matching local file are deleted.
+// Symlinks are followed or skipped according to options.Symlinks, they cannot be stored as symlink objects.
+func SyncToRemote(token string, server string, options Options) (SyncResult, error) {
+	result := SyncResult{Errors: make(map[string]string)}
+	if options.Symlinks == SymlinksStore {
+		return result, errors.New("symlinks cannot be stored on sync, follow or skip them")
+	}
+	remote := syncListing(token, server, options)
+	local := make(map[string]bool)
+	err := WalkLinks(options.File, options.Filter, options.Symlinks, output(options), func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(options.File, localPath)
+		if err != nil {
+			return err
+		}
+		name := syncObjectName(options.Prefix, filepath.ToSlash(rel))
+		if info.IsDir() {
+			// keep directory markers of existing directories
+			local[name] = true
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			logger.Debugf("Skip %s, not a regular file", localPath)
+			return nil
+		}
+		local[name] = true
+		if file, ok := remote[name]; ok {
+			changed, err := localChanged(token, server, options, localPath, info, file)
+			if err != nil {
+				result.Errors[name] = err.Error()
+				return nil
+			}
+			if !changed {
+				logger.Debugf("Skip %s, unchanged", localPath)
+				result.Unchanged++
+				return nil
+			}
+		}
+		fileOptions := options
+		fileOptions.File = localPath
+		fileOptions.ObjectName = name
+		fileOptions.Meta = map[string]string{mtimeMeta: formatMtime(info.ModTime())}
+		for k, v := range options.Meta {
+			fileOptions.Meta[k] = v
+		}
+		if !Upload(token, server, fileOptions) {
+			result.Errors[name] = "upload failed"
+			return nil
+		}
+		result.Transferred = append(result.Transferred, name)
+		result.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	if !options.DeleteExtra {
+		return result, nil
+	}
+	var extra []SwiftFile
+	for name, file := range remote {
+		if !local[name] {
+			extra = append(extra, file)
+		}
+	}
+	if len(extra) == 0 {
+		return result, nil
+	}
+	deleteOptions := options
+	deleteOptions.LeaveSegments = keepSegments(token, server, options)
+	var paths []string
+	var size int64
+	for _, file := range extra {
+		if !options.DryRun {
+			fmt.Printf("Delete %s\n", file.Name)
+		}
+		filePaths, fileSize := objectPaths(token, server, deleteOptions, file)
+		paths = append(paths, filePaths...)
+		size += fileSize
+	}
+	bulkResult, err := deleteObjects(token, server, deleteOptions, len(extra), paths, size)
+	if err != nil && len(bulkResult.Errors) == 0 {
+		// deletion cancelled
+		return result, err
+	}
+	for _, file := range extra {
+		if reason, ok := bulkResult.Errors[objectPath(options.Bucket, file.Name)]; ok {
+			result.Errors[file.Name] = reason
+		} else {
+			result.Deleted = append(result.Deleted, file.Name)
+		}
+	}
+	return result, nil
+}
+
+// syncLocalPath returns local path of object name under local directory dir,
+// refusing names escaping dir
+func syncLocalPath(dir string, prefix string, name string) (string, error) {
+	rel := name
+	if prefix != "" {
+		rel = strings.TrimPrefix(name, strings.TrimSuffix(prefix, "/")+"/")
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("object name %s escapes local directory", name)
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel)), nil
+}
+
+// isDirMarker checks if object is a pseudo-directory
+func isDirMarker(file SwiftFile) bool {
+	return strings.HasSuffix(file.Name, "/") || file.ContentType == DirectoryContentType
+}
+
+// clearParents makes sure parent directories of localPath under dir are not files,
+// removing such files if options.DeleteExtra is set
+func clearParents(dir string, localPath string, options Options, result *SyncResult) error {
+	for parent := filepath.Dir(localPath); len(parent) > len(dir); parent = filepath.Dir(parent) {
+		info, err := os.Lstat(parent)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if !options.DeleteExtra {
+			return fmt.Errorf("local file %s conflicts with remote directory", parent)
+		}
+		if options.DryRun {
+			fmt.Printf("Would delete %s\n", parent)
+		} else {
+			fmt.Printf("Delete %s\n", parent)
+			if err := os.Remove(parent); err != nil {
+				return err
+			}
+		}
+		result.Deleted = append(result.Deleted, parent)
+	}
+	return nil
+}
+
+// downloadReplace downloads options.File to a temporary file renamed as options.ObjectName
+//
+// A file replaced at options.ObjectName during download is never written to, only replaced.
+func downloadReplace(token string, server string, options Options) error {
+	localPath := options.ObjectName
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(localPath), ".hero-")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	// temporary files are only readable by owner
+	os.Chmod(tmp.Name(), 0644)
+	options.ObjectName = tmp.Name()
+	if !Download(token, server, options) {
+		os.Remove(tmp.Name())
+		return errors.New("download failed")
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// SyncFromRemote downloads new and changed objects of options.Bucket under options.Prefix
+// to local directory options.File
+//
+// Local modification times are set from Mtime meta data, or object last modification.
+// If options.DeleteExtra is set, local files with no matching object are deleted.
+// An object conflicting with a pseudo-directory of same name (a and a/b) is not downloaded.
+func SyncFromRemote(token string, server string, options Options) (SyncResult, error) {
+	result := SyncResult{Errors: make(map[string]string)}
+	if options.Symlinks != "" {
+		// local symlinks are never followed nor replaced on download
+		return result, errors.New("symlink policies only apply to sync of a local directory to a bucket")
+	}
+	options.File = filepath.Clean(options.File)
+	if !options.DryRun {
+		if err := os.MkdirAll(options.File, 0755); err != nil {
+			return result, err
+		}
+	}
+	remote := syncListing(token, server, options)
+	dirs := make(map[string]bool)
+	for name := range remote {
+		for dir := path.Dir(strings.TrimSuffix(name, "/")); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	local := make(map[string]bool)
+	var names []string
+	for name := range remote {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := remote[name]
+		localPath, err := syncLocalPath(options.File, options.Prefix, name)
+		if err != nil {
+			result.Errors[name] = err.Error()
+			continue
+		}
+		if isDirMarker(file) {
+			local[localPath] = true
+			if err := clearParents(options.File, filepath.Join(localPath, "x"), options, &result); err != nil {
+				result.Errors[name] = err.Error()
+				continue
+			}
+			if options.DryRun {
+				fmt.Printf("Would create directory %s\n", localPath)
+			} else if err := os.MkdirAll(localPath, 0755); err != nil {
+				result.Errors[name] = err.Error()
+			}
+			continue
+		}
+		if dirs[name] {
+			result.Errors[name] = "object conflicts with pseudo-directory of same name"
+			continue
+		}
+		local[localPath] = true
+		if err := clearParents(options.File, localPath, options, &result); err != nil {
+			result.Errors[name] = err.Error()
+			continue
+		}
+		if info, err := os.Lstat(localPath); err == nil {
+			if info.IsDir() {
+				result.Errors[name] = "object conflicts with local directory " + localPath
+				continue
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				// downloading would write to symlink target, maybe out of local directory
+				result.Errors[name] = "object conflicts with local symlink " + localPath
+				continue
+			}
+			changed, err := localChanged(token, server, options, localPath, info, file)
+			if err != nil {
+				result.Errors[name] = err.Error()
+				continue
+			}
+			if !changed {
+				logger.Debugf("Skip %s, unchanged", name)
+				result.Unchanged++
+				continue
+			}
+		}
+		fileOptions := options
+		fileOptions.File = name
+		fileOptions.ObjectName = localPath
+		if !options.DryRun {
+			fmt.Printf("Download %s => %s\n", name, localPath)
+			if err := downloadReplace(token, server, fileOptions); err != nil {
+				result.Errors[name] = err.Error()
+				continue
+			}
+		} else if !Download(token, server, fileOptions) {
+			result.Errors[name] = "download failed"
+			continue
+		}
+		if !options.DryRun {
+			if meta, err := Show(token, server, Options{Bucket: options.Bucket, File: name}); err == nil {
+				if mtime, ok := remoteMtime(meta); ok {
+					os.Chtimes(localPath, mtime, mtime)
+				}
+			}
+		}
+		result.Transferred = append(result.Transferred, name)
+		result.Bytes += int64(file.Bytes)
+	}
+	if !options.DeleteExtra {
+		return result, nil
+	}
+	if _, err := os.Stat(options.File); os.IsNotExist(err) && options.DryRun {
+		return result, nil
+	}
+	var extraDirs []string
+	err := WalkFiltered(options.File, options.Filter, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if localPath == options.File || local[localPath] {
+			return nil
+		}
+		if info.IsDir() {
+			extraDirs = append(extraDirs, localPath)
+			return nil
+		}
+		if options.DryRun {
+			fmt.Printf("Would delete %s\n", localPath)
+			result.Deleted = append(result.Deleted, localPath)
+			return nil
+		}
+		fmt.Printf("Delete %s\n", localPath)
+		if err := os.Remove(localPath); err != nil {
+			result.Errors[localPath] = err.Error()
+			return nil
+		}
+		result.Deleted = append(result.Deleted, localPath)
+		return nil
+	})
+	// remove emptied directories, deepest first
+	for i := len(extraDirs) - 1; i >= 0 && !options.DryRun; i-- {
+		// only empty directories can be removed
+		if os.Remove(extraDirs[i]) == nil {
+			result.Deleted = append(result.Deleted, extraDirs[i])
+		}
+	}
+	return result, err
+}
@@ -0,0 +1,239 @@
+package swift_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftSyncToRemote(t *testing.T) {
+	puts := make(map[string]string)
+	var deleted []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			if req.URL.Path != "/project" || req.URL.Query().Get("prefix") != "backup/" || req.URL.Query().Get("marker") != "" {
+				res.WriteHeader(200)
+				res.Write([]byte(`[]`))
+				return
+			}
+			res.WriteHeader(200)
+			// md5 of hello is 5d41402abc4b2a76b9719d911017c592
+			res.Write([]byte(`[{"name": "backup/a.txt", "bytes": 5, "hash": "5d41402abc4b2a76b9719d911017c592"},
+				{"name": "backup/sub/b.txt", "bytes": 3, "hash": "00000000000000000000000000000000"},
+				{"name": "backup/old.txt", "bytes": 3, "hash": "00000000000000000000000000000000"}]`))
+		case "PUT":
+			puts[req.URL.Path] = req.Header.Get("X-Object-Meta-Mtime")
+			res.WriteHeader(201)
+		case "DELETE":
+			deleted = append(deleted, req.URL.Path)
+			res.WriteHeader(204)
+		default:
+			res.WriteHeader(404)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("new"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("c"), 0644)
+
+	options := swift.Options{Bucket: "project", Prefix: "backup", File: dir, Size: 100, DeleteExtra: true}
+	result, err := swift.SyncToRemote("123", testServer.URL, options)
+	if err != nil {
+		t.Fatalf("sync failed: %s", err)
+	}
+	sort.Strings(result.Transferred)
+	if strings.Join(result.Transferred, ",") != "backup/c.txt,backup/sub/b.txt" || result.Unchanged != 1 {
+		t.Errorf("wrong transferred files: %+v", result)
+	}
+	if len(puts) != 2 || puts["/project/backup/c.txt"] == "" {
+		t.Errorf("wrong uploads: %v", puts)
+	}
+	if len(deleted) != 1 || deleted[0] != "/project/backup/old.txt" || len(result.Deleted) != 1 {
+		t.Errorf("wrong deletions: %v", deleted)
+	}
+
+	options.Symlinks = swift.SymlinksStore
+	if _, err := swift.SyncToRemote("123", testServer.URL, options); err == nil {
+		t.Errorf("symlinks store policy accepted on sync")
+	}
+}
+
+func TestSwiftSyncFromRemote(t *testing.T) {
+	downloads := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			if req.URL.Path == "/project" {
+				res.WriteHeader(200)
+				if req.URL.Query().Get("marker") != "" {
+					res.Write([]byte(`[]`))
+					return
+				}
+				res.Write([]byte(`[{"name": "backup/a", "bytes": 1, "hash": "0cc175b9c0f1b6a831c399e269772661"},
+					{"name": "backup/a/b", "bytes": 1, "hash": "92eb5ffee6ae2fec3ad71c777531578f"},
+					{"name": "backup/c", "bytes": 5, "hash": "5d41402abc4b2a76b9719d911017c592"},
+					{"name": "backup/d/", "bytes": 0, "content_type": "application/directory"},
+					{"name": "backup/../escape", "bytes": 1}]`))
+				return
+			}
+			downloads++
+			res.WriteHeader(200)
+			res.Write([]byte("b"))
+		case "HEAD":
+			res.Header().Set("X-Object-Meta-Mtime", "1500000000.000000")
+			res.WriteHeader(200)
+		default:
+			res.WriteHeader(404)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	// a is a file locally, c is up to date, extra is not in bucket
+	ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "c"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "extra"), []byte("x"), 0644)
+
+	options := swift.Options{Bucket: "project", Prefix: "backup", File: dir, DeleteExtra: true}
+	result, err := swift.SyncFromRemote("123", testServer.URL, options)
+	if err != nil {
+		t.Fatalf("sync failed: %s", err)
+	}
+	if downloads != 1 || len(result.Transferred) != 1 || result.Transferred[0] != "backup/a/b" || result.Unchanged != 1 {
+		t.Errorf("wrong transferred files: %+v", result)
+	}
+	if _, ok := result.Errors["backup/a"]; !ok {
+		t.Errorf("conflicting object not reported: %v", result.Errors)
+	}
+	if _, ok := result.Errors["backup/../escape"]; !ok {
+		t.Errorf("object escaping directory not reported: %v", result.Errors)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "a", "b")); err != nil || info.ModTime().Unix() != 1500000000 {
+		t.Errorf("file not downloaded with its mtime: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "d")); err != nil || !info.IsDir() {
+		t.Errorf("directory marker not created")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "extra")); !os.IsNotExist(err) {
+		t.Errorf("extra local file not deleted")
+	}
+}
+
+func TestSwiftSyncFromRemoteSymlink(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/project" {
+			res.WriteHeader(200)
+			if req.URL.Query().Get("marker") != "" {
+				res.Write([]byte(`[]`))
+				return
+			}
+			res.Write([]byte(`[{"name": "backup/link", "bytes": 6, "hash": "00000000000000000000000000000000"},
+				{"name": "backup/new", "bytes": 6, "hash": "00000000000000000000000000000000"}]`))
+			return
+		}
+		res.WriteHeader(200)
+		res.Write([]byte("remote"))
+	}))
+	defer func() { testServer.Close() }()
+
+	outside, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(outside)
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(outside, "secret.txt")
+	ioutil.WriteFile(secret, []byte("secret"), 0644)
+	if err := os.Symlink(secret, filepath.Join(dir, "link")); err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	}
+
+	options := swift.Options{Bucket: "project", Prefix: "backup", File: dir}
+	result, _ := swift.SyncFromRemote("123", testServer.URL, options)
+	if _, ok := result.Errors["backup/link"]; !ok {
+		t.Errorf("conflicting symlink not reported: %+v", result)
+	}
+	if content, _ := ioutil.ReadFile(secret); string(content) != "secret" {
+		t.Errorf("symlink target out of directory overwritten: %s", content)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "new")); string(content) != "remote" {
+		t.Errorf("file not downloaded: %s", content)
+	}
+	// temporary download files are renamed
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("wrong local files: %d", len(files))
+	}
+}
+
+func TestSwiftSyncMtime(t *testing.T) {
+	var mtime string
+	puts := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			if req.URL.Path != "/project" || req.URL.Query().Get("marker") != "" || mtime == "" {
+				res.WriteHeader(404)
+				return
+			}
+			res.WriteHeader(200)
+			// manifest of a segmented object
+			res.Write([]byte(`[{"name": "backup/big.txt", "bytes": 0}]`))
+		case "HEAD":
+			res.Header().Set("X-Object-Manifest", "project_segments/backup/big.txt/1")
+			res.Header().Set("Content-Length", "20")
+			res.Header().Set("X-Object-Meta-Mtime", mtime)
+			res.WriteHeader(200)
+		case "PUT":
+			puts++
+			if req.URL.Path == "/project/backup/big.txt" {
+				mtime = req.Header.Get("X-Object-Meta-Mtime")
+			}
+			res.WriteHeader(201)
+		default:
+			res.WriteHeader(404)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+	localPath := filepath.Join(dir, "big.txt")
+	ioutil.WriteFile(localPath, []byte("01234567890123456789"), 0644)
+	modTime := time.Unix(1500000000, 123456789)
+	os.Chtimes(localPath, modTime, modTime)
+	info, _ := os.Stat(localPath)
+
+	options := swift.Options{Bucket: "project", Prefix: "backup", File: dir, Size: 10}
+	if _, err := swift.SyncToRemote("123", testServer.URL, options); err != nil {
+		t.Fatalf("sync failed: %s", err)
+	}
+	parts := strings.SplitN(mtime, ".", 2)
+	seconds, _ := strconv.ParseInt(parts[0], 10, 64)
+	micros := int64(-1)
+	if len(parts) == 2 && len(parts[1]) == 6 {
+		micros, _ = strconv.ParseInt(parts[1], 10, 64)
+	}
+	if !time.Unix(seconds, micros*1000).Equal(info.ModTime().Truncate(time.Microsecond)) {
+		t.Fatalf("mtime %s does not match local mtime %s", mtime, info.ModTime())
+	}
+
+	// stored mtime matches local file, nothing to upload
+	puts = 0
+	result, err := swift.SyncToRemote("123", testServer.URL, options)
+	if err != nil || result.Unchanged != 1 || puts != 0 {
+		t.Errorf("unchanged file uploaded again: %+v, %d uploads", result, puts)
+	}
+}
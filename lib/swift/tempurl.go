@@ -0,0 +1,163 @@
+package swift
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TempURLOptions defines a temporary url
+type TempURLOptions struct {
+	// Method allowed by url, GET by default
+	Method string
+	// Expires is the url expiration time
+	Expires time.Time
+	// Key to sign url, container or account Temp-URL-Key if empty
+	Key string
+	// Digest is the signature algorithm: sha1, sha256 (default) or sha512
+	Digest string
+	// Prefix signs options.Prefix, url is valid for all objects with this prefix
+	Prefix bool
+	// IPRange restricts url usage to an ip or network (CIDR)
+	IPRange string
+}
+
+func digestHash(digest string) (func() hash.Hash, error) {
+	switch digest {
+	case "sha1":
+		return sha1.New, nil
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported digest %s", digest)
+}
+
+// hmacSignature signs body with key, sha1 and sha256 signatures are hex encoded,
+// sha512 ones are base64 encoded and prefixed with digest name as expected by Swift
+func hmacSignature(key string, digest string, body string) (string, error) {
+	h, err := digestHash(digest)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(h, []byte(key))
+	mac.Write([]byte(body))
+	if digest == "sha512" {
+		return "sha512:" + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+	}
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// TempURLSignature computes the signature of a temporary url
+//
+// path is the object path /v1/AUTH_XXX/container/object, or prefix:/v1/AUTH_XXX/container/prefix
+// for prefix based urls
+func TempURLSignature(key string, digest string, method string, expires int64, path string, ipRange string) (string, error) {
+	body := fmt.Sprintf("%s\n%d\n%s", method, expires, path)
+	if ipRange != "" {
+		body = fmt.Sprintf("ip=%s\n%s", ipRange, body)
+	}
+	return hmacSignature(key, digest, body)
+}
+
+// tempURLKey gets Temp-URL-Key of container, or account if container has none
+func tempURLKey(token string, server string, bucket string) (string, error) {
+	containerMeta, err := Show(token, server, Options{Bucket: bucket})
+	if err != nil {
+		return "", err
+	}
+	if key := containerMeta["X-Container-Meta-Temp-Url-Key"]; key != "" {
+		return key, nil
+	}
+	accountMeta, err := Show(token, server, Options{})
+	if err != nil {
+		return "", err
+	}
+	if key := accountMeta["X-Account-Meta-Temp-Url-Key"]; key != "" {
+		return key, nil
+	}
+	return "", errors.New("no Temp-URL-Key defined for container or account")
+}
+
+// TempURL generates a temporary url to object options.File of options.Bucket
+//
+// If tempURL.Prefix is set, url gives access to all objects with options.Prefix.
+func TempURL(token string, server string, options Options, tempURL TempURLOptions) (string, error) {
+	method := strings.ToUpper(tempURL.Method)
+	if method == "" {
+		method = "GET"
+	}
+	if _, err := digestHash(tempURL.Digest); err != nil {
+		return "", err
+	}
+	if info, err := Capabilities(token, server); err == nil && info.Has("tempurl") {
+		if digests, ok := info["tempurl"]["allowed_digests"].([]interface{}); ok {
+			allowed := false
+			for _, d := range digests {
+				if d == tempURL.Digest || (tempURL.Digest == "" && d == "sha256") {
+					allowed = true
+				}
+			}
+			if !allowed {
+				return "", fmt.Errorf("digest %s not allowed by cluster, allowed: %v", tempURL.Digest, digests)
+			}
+		}
+	}
+	key := tempURL.Key
+	if key == "" {
+		var err error
+		key, err = tempURLKey(token, server, options.Bucket)
+		if err != nil {
+			return "", err
+		}
+	}
+	u, err := neturl.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	accountPath := strings.TrimSuffix(u.Path, "/")
+	var objectPath string
+	if tempURL.Prefix {
+		objectPath = strings.Join([]string{accountPath, options.Bucket, options.Prefix}, "/")
+	} else {
+		objectPath = strings.Join([]string{accountPath, options.Bucket, options.File}, "/")
+	}
+	signedPath := objectPath
+	if tempURL.Prefix {
+		signedPath = "prefix:" + objectPath
+	}
+	expires := tempURL.Expires.Unix()
+	sig, err := TempURLSignature(key, tempURL.Digest, method, expires, signedPath, tempURL.IPRange)
+	if err != nil {
+		return "", err
+	}
+	q := neturl.Values{}
+	q.Set("temp_url_sig", sig)
+	q.Set("temp_url_expires", strconv.FormatInt(expires, 10))
+	if tempURL.Prefix {
+		q.Set("temp_url_prefix", options.Prefix)
+	}
+	if tempURL.IPRange != "" {
+		q.Set("temp_url_ip_range", tempURL.IPRange)
+	}
+	u.Path = objectPath
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// SetTempURLKey sets Temp-URL-Key of container options.Bucket, or of account if no bucket is given
+func SetTempURLKey(token string, server string, options Options, key string) error {
+	keyOptions := Options{Bucket: options.Bucket, Meta: map[string]string{"Temp-URL-Key": key}}
+	return Post(token, server, keyOptions)
+}
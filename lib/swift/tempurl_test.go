@@ -0,0 +1,58 @@
+package swift_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftTempURLSignature(t *testing.T) {
+	sig, _ := swift.TempURLSignature("secret", "sha256", "GET", 1500000000, "/v1/AUTH_test/project/file.txt", "")
+	if sig != "9056557cddaf1efb4994a6b23b6bda2f2d592f7501a15b9de99e47dd60ad997d" {
+		t.Errorf("wrong sha256 signature: %s", sig)
+	}
+	sig, _ = swift.TempURLSignature("secret", "sha1", "PUT", 1500000000, "prefix:/v1/AUTH_test/project/in/", "10.0.0.0/8")
+	if sig != "800ef7f9bc192383396f2ec033675be5fbe7b077" {
+		t.Errorf("wrong sha1 prefix signature: %s", sig)
+	}
+	sig, _ = swift.TempURLSignature("secret", "sha512", "GET", 1500000000, "/v1/AUTH_test/project/file.txt", "")
+	if sig != "sha512:CgYDHBmxRi--GSstjTHE4Z-Fy4PbMU6rZ_xV2c9oa75pyBwZD746iHnqS4I8zX_fnGNBVAZbp1BkNiHXEGNYFw" {
+		t.Errorf("wrong sha512 signature: %s", sig)
+	}
+	if _, err := swift.TempURLSignature("secret", "md5", "GET", 1500000000, "/", ""); err == nil {
+		t.Error("md5 should not be supported")
+	}
+}
+
+func TestSwiftTempURL(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == "HEAD" && req.URL.Path == "/v1/AUTH_test/project/" {
+			res.Header().Set("X-Container-Meta-Temp-Url-Key", "secret")
+			res.WriteHeader(204)
+			return
+		}
+		res.WriteHeader(404)
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "project", File: "file.txt"}
+	tempURL := swift.TempURLOptions{Expires: time.Unix(1500000000, 0)}
+	res, err := swift.TempURL("123", testServer.URL+"/v1/AUTH_test", options, tempURL)
+	if err != nil {
+		t.Fatalf("failed to generate url: %s", err)
+	}
+	u, _ := url.Parse(res)
+	if u.Path != "/v1/AUTH_test/project/file.txt" {
+		t.Errorf("wrong path: %s", u.Path)
+	}
+	if u.Query().Get("temp_url_sig") != "9056557cddaf1efb4994a6b23b6bda2f2d592f7501a15b9de99e47dd60ad997d" {
+		t.Errorf("wrong signature: %s", res)
+	}
+	if u.Query().Get("temp_url_expires") != "1500000000" {
+		t.Errorf("wrong expiration: %s", res)
+	}
+}
@@ -0,0 +1,309 @@
+package swift
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+)
+
+// Versioning modes
+const (
+	// VersioningStack keeps versions in X-Versions-Location, delete restores previous version
+	VersioningStack = "stack"
+	// VersioningHistory keeps versions in X-History-Location, delete archives current version
+	VersioningHistory = "history"
+	// VersioningNative uses X-Versions-Enabled object versioning
+	VersioningNative = "native"
+)
+
+// Versioning describes container versioning
+type Versioning struct {
+	// Mode is stack, history, native, or empty if versioning is disabled
+	Mode string
+	// Location is the archive container of stack and history modes
+	Location string
+}
+
+// ObjectVersion describes a version of an object
+type ObjectVersion struct {
+	ID           string
+	Bytes        uint64
+	Hash         string
+	LastModified string
+	IsLatest     bool
+}
+
+type nativeVersion struct {
+	Name         string `json:"name"`
+	VersionID    string `json:"version_id"`
+	IsLatest     bool   `json:"is_latest"`
+	Bytes        uint64 `json:"bytes"`
+	Hash         string `json:"hash"`
+	LastModified string `json:"last_modified"`
+}
+
+var versioningCache = make(map[string]Versioning)
+var versioningLock sync.Mutex
+
+// GetVersioning returns versioning configuration of a container
+func GetVersioning(token string, server string, bucket string) (Versioning, error) {
+	versioningLock.Lock()
+	defer versioningLock.Unlock()
+	key := server + "/" + bucket
+	if v, ok := versioningCache[key]; ok {
+		return v, nil
+	}
+	info, err := Show(token, server, Options{Bucket: bucket})
+	if err != nil {
+		return Versioning{}, err
+	}
+	v := Versioning{}
+	if strings.ToLower(info["X-Versions-Enabled"]) == "true" {
+		v.Mode = VersioningNative
+	} else if location := info["X-History-Location"]; location != "" {
+		v.Mode = VersioningHistory
+		v.Location = location
+	} else if location := info["X-Versions-Location"]; location != "" {
+		v.Mode = VersioningStack
+		v.Location = location
+	}
+	versioningCache[key] = v
+	return v, nil
+}
+
+// isVersioned checks if container keeps versions of objects, in which case
+// segments of overwritten or deleted manifests may still back a version
+func isVersioned(token string, server string, bucket string) bool {
+	v, err := GetVersioning(token, server, bucket)
+	if err != nil {
+		logger.Debugf("Failed to get versioning of %s: %s", bucket, err)
+		return false
+	}
+	return v.Mode != ""
+}
+
+// SetVersioning enables versioning on container options.Bucket, or disables it if v.Mode is empty
+//
+// Archive container of stack and history modes is created if missing.
+func SetVersioning(token string, server string, options Options, v Versioning) error {
+	headers := make(map[string]string)
+	switch v.Mode {
+	case "":
+		headers["X-Remove-Versions-Location"] = "x"
+		headers["X-Remove-History-Location"] = "x"
+		headers["X-Versions-Enabled"] = "false"
+	case VersioningNative:
+		headers["X-Versions-Enabled"] = "true"
+	case VersioningStack, VersioningHistory:
+		if v.Location == "" {
+			v.Location = options.Bucket + "_versions"
+		}
+		if err := EnsureContainers(token, server, Options{Bucket: v.Location, StoragePolicy: options.StoragePolicy}); err != nil {
+			return err
+		}
+		if v.Mode == VersioningStack {
+			headers["X-Versions-Location"] = v.Location
+			headers["X-Remove-History-Location"] = "x"
+		} else {
+			headers["X-History-Location"] = v.Location
+			headers["X-Remove-Versions-Location"] = "x"
+		}
+	default:
+		return fmt.Errorf("unknown versioning mode %s", v.Mode)
+	}
+	versioningLock.Lock()
+	delete(versioningCache, server+"/"+options.Bucket)
+	versioningLock.Unlock()
+	return postHeaders(token, server, options.Bucket, "", headers)
+}
+
+// archivePrefix returns the prefix of versions of object in archive container of stack and history modes
+func archivePrefix(object string) string {
+	return fmt.Sprintf("%03x%s/", len(object), object)
+}
+
+// ListVersions lists versions of object options.File
+func ListVersions(token string, server string, options Options) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	v, err := GetVersioning(token, server, options.Bucket)
+	if err != nil {
+		return versions, err
+	}
+	switch v.Mode {
+	case "":
+		return versions, fmt.Errorf("versioning is not enabled on %s", options.Bucket)
+	case VersioningNative:
+		return listNativeVersions(token, server, options)
+	}
+	prefix := archivePrefix(options.File)
+	for _, file := range List(token, server, Options{Bucket: v.Location, Prefix: prefix}) {
+		versions = append(versions, ObjectVersion{
+			ID:           strings.TrimPrefix(file.Name, prefix),
+			Bytes:        file.Bytes,
+			Hash:         file.Hash,
+			LastModified: file.LastModified,
+		})
+	}
+	return versions, nil
+}
+
+func listNativeVersions(token string, server string, options Options) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	client := &http.Client{}
+	url := []string{server, options.Bucket}
+	marker := ""
+	versionMarker := ""
+	for {
+		q := neturl.Values{}
+		q.Set("format", "json")
+		q.Set("prefix", options.File)
+		if marker != "" {
+			q.Set("marker", marker)
+			q.Set("version_marker", versionMarker)
+		}
+		reqURL := strings.Join(url, "/") + "?versions&" + q.Encode()
+		logger.Debugf("Call %s\n", reqURL)
+		req, _ := http.NewRequest("GET", reqURL, nil)
+		req.Header.Add("X-Auth-Token", token)
+		req.Header.Add("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			logger.Errorf("Failed to contact server %s\n", server)
+			return versions, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return versions, err
+		}
+		if resp.StatusCode == 204 {
+			return versions, nil
+		}
+		if resp.StatusCode != 200 {
+			logger.Errorf("Error: %s\n", resp.Status)
+			return versions, errors.New(resp.Status)
+		}
+		var page []nativeVersion
+		if err := json.Unmarshal(body, &page); err != nil {
+			logger.Errorf("Failed to decode answer\n")
+			return versions, err
+		}
+		if len(page) == 0 {
+			return versions, nil
+		}
+		for _, version := range page {
+			if version.Name != options.File {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				ID:           version.VersionID,
+				Bytes:        version.Bytes,
+				Hash:         version.Hash,
+				LastModified: version.LastModified,
+				IsLatest:     version.IsLatest,
+			})
+		}
+		marker = page[len(page)-1].Name
+		versionMarker = page[len(page)-1].VersionID
+	}
+}
+
+// versionOptions returns options to access version options.VersionID of object options.File
+//
+// In native mode, VersionID is kept and sent as version-id query parameter,
+// else options point to the archived object.
+func versionOptions(token string, server string, options Options) (Options, error) {
+	v, err := GetVersioning(token, server, options.Bucket)
+	if err != nil {
+		return options, err
+	}
+	switch v.Mode {
+	case "":
+		return options, fmt.Errorf("versioning is not enabled on %s", options.Bucket)
+	case VersioningNative:
+		return options, nil
+	}
+	if options.ObjectName == "" {
+		options.ObjectName = options.File
+	}
+	options.Bucket = v.Location
+	options.File = archivePrefix(options.File) + options.VersionID
+	options.VersionID = ""
+	return options, nil
+}
+
+// versionQuery returns query string selecting options.VersionID, if any
+func versionQuery(options Options) string {
+	if options.VersionID == "" {
+		return ""
+	}
+	return "version-id=" + neturl.QueryEscape(options.VersionID)
+}
+
+// DownloadVersion downloads version options.VersionID of object options.File
+func DownloadVersion(token string, server string, options Options) bool {
+	vOptions, err := versionOptions(token, server, options)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return false
+	}
+	return Download(token, server, vOptions)
+}
+
+// RestoreVersion makes version options.VersionID the current version of object options.File
+func RestoreVersion(token string, server string, options Options) error {
+	vOptions, err := versionOptions(token, server, options)
+	if err != nil {
+		return err
+	}
+	query := "multipart-manifest=get"
+	if q := versionQuery(vOptions); q != "" {
+		query = query + "&" + q
+	}
+	if options.DryRun {
+		fmt.Printf("Would restore %s version %s\n", options.File, options.VersionID)
+		return nil
+	}
+	fmt.Printf("Restore %s version %s\n", options.File, options.VersionID)
+	return copyObject(token, server, vOptions.Bucket, vOptions.File, options.Bucket, options.File, query, nil)
+}
+
+// DeleteVersion deletes version options.VersionID of object options.File
+//
+// Segments of a large object version are kept, as they may back other versions.
+func DeleteVersion(token string, server string, options Options) error {
+	vOptions, err := versionOptions(token, server, options)
+	if err != nil {
+		return err
+	}
+	if options.DryRun {
+		fmt.Printf("Would delete %s version %s\n", options.File, options.VersionID)
+		return nil
+	}
+	client := &http.Client{}
+	url := []string{server, vOptions.Bucket, vOptions.File}
+	reqURL := strings.Join(url, "/")
+	if q := versionQuery(vOptions); q != "" {
+		reqURL = reqURL + "?" + q
+	}
+	logger.Debugf("Call %s\n", reqURL)
+	req, _ := http.NewRequest("DELETE", reqURL, nil)
+	req.Header.Add("X-Auth-Token", token)
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorf("Failed to contact server %s\n", server)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 204 {
+		logger.Errorf("Error: %s\n", resp.Status)
+		return errors.New(resp.Status)
+	}
+	fmt.Printf("Deleted %s version %s\n", options.File, options.VersionID)
+	return nil
+}
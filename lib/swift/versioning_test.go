@@ -0,0 +1,94 @@
+package swift_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+func TestSwiftHistoryVersions(t *testing.T) {
+	var copied, deleted string
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "HEAD" && req.URL.Path == "/project/":
+			res.Header().Set("X-History-Location", "archive")
+			res.WriteHeader(204)
+		case req.Method == "GET" && req.URL.Path == "/archive":
+			res.WriteHeader(200)
+			if req.URL.Query().Get("prefix") != "006myfile/" || req.URL.Query().Get("marker") != "" {
+				res.Write([]byte(`[]`))
+				return
+			}
+			res.Write([]byte(`[{"name": "006myfile/1500000000.00000", "bytes": 3}, {"name": "006myfile/1600000000.00000", "bytes": 4}]`))
+		case req.Method == "COPY":
+			copied = req.URL.Path + " => " + req.Header.Get("Destination")
+			res.WriteHeader(201)
+		case req.Method == "DELETE":
+			deleted = req.URL.Path
+			res.WriteHeader(204)
+		default:
+			res.WriteHeader(404)
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "project", File: "myfile"}
+	versions, err := swift.ListVersions("123", testServer.URL, options)
+	if err != nil {
+		t.Fatalf("failed to list versions: %s", err)
+	}
+	if len(versions) != 2 || versions[0].ID != "1500000000.00000" {
+		t.Errorf("wrong versions: %+v", versions)
+	}
+
+	options.VersionID = "1500000000.00000"
+	if err := swift.RestoreVersion("123", testServer.URL, options); err != nil {
+		t.Errorf("restore failed: %s", err)
+	}
+	if copied != "/archive/006myfile/1500000000.00000 => /project/myfile" {
+		t.Errorf("wrong restore copy: %s", copied)
+	}
+	if err := swift.DeleteVersion("123", testServer.URL, options); err != nil {
+		t.Errorf("delete failed: %s", err)
+	}
+	if deleted != "/archive/006myfile/1500000000.00000" {
+		t.Errorf("wrong version deleted: %s", deleted)
+	}
+}
+
+func TestSwiftVersionedSegmentsKept(t *testing.T) {
+	deletes := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "HEAD":
+			if req.URL.Path == "/versioned/" {
+				res.Header().Set("X-Versions-Enabled", "True")
+				res.WriteHeader(204)
+				return
+			}
+			res.Header().Set("X-Object-Manifest", "versioned_segments/large/1/2")
+			res.WriteHeader(200)
+		case "DELETE":
+			deletes++
+			res.WriteHeader(204)
+		case "POST":
+			res.WriteHeader(404)
+		default:
+			res.WriteHeader(200)
+			if req.URL.Path == "/versioned_segments" && req.URL.Query().Get("marker") == "" {
+				res.Write([]byte(`[{"name": "large/1/2/0000000000", "bytes": 2}]`))
+				return
+			}
+			res.Write([]byte(`[]`))
+		}
+	}))
+	defer func() { testServer.Close() }()
+
+	options := swift.Options{Bucket: "versioned", File: "large"}
+	swift.DeleteWithSegments("123", testServer.URL, options)
+	if deletes != 1 {
+		t.Errorf("only manifest should be deleted, got %d deletes", deletes)
+	}
+}
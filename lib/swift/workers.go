@@ -0,0 +1,88 @@
+package swift
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// output returns the writer of options progress messages
+func output(options Options) io.Writer {
+	if options.Output != nil {
+		return options.Output
+	}
+	return os.Stdout
+}
+
+// printf writes a progress message to options.Output, stdout if not set
+func printf(options Options, format string, a ...interface{}) {
+	fmt.Fprintf(output(options), format, a...)
+}
+
+// ObjectTask processes an object, writing its progress messages to out
+type ObjectTask func(out io.Writer) error
+
+// ObjectsError aggregates errors of a multiple objects operation
+type ObjectsError struct {
+	// Total number of objects
+	Total  int
+	Errors []error
+}
+
+func (e *ObjectsError) Error() string {
+	msg := []string{fmt.Sprintf("%d of %d objects failed", len(e.Errors), e.Total)}
+	for _, err := range e.Errors {
+		msg = append(msg, "\t"+err.Error())
+	}
+	return strings.Join(msg, "\n")
+}
+
+// RunObjects runs tasks with threads concurrent workers and returns an *ObjectsError if some failed
+//
+// With more than one worker, messages of each task are buffered and written to stdout
+// in tasks order once task is done, so that messages of objects are not interleaved.
+func RunObjects(threads int, tasks []ObjectTask) error {
+	errs := &ObjectsError{Total: len(tasks)}
+	if threads <= 1 {
+		for _, task := range tasks {
+			if err := task(os.Stdout); err != nil {
+				errs.Errors = append(errs.Errors, err)
+			}
+		}
+	} else {
+		outputs := make([]bytes.Buffer, len(tasks))
+		results := make([]error, len(tasks))
+		done := make([]chan bool, len(tasks))
+		for i := range done {
+			done[i] = make(chan bool)
+		}
+		indexes := make(chan int)
+		for w := 0; w < threads; w++ {
+			go func() {
+				for i := range indexes {
+					results[i] = tasks[i](&outputs[i])
+					close(done[i])
+				}
+			}()
+		}
+		go func() {
+			for i := range tasks {
+				indexes <- i
+			}
+			close(indexes)
+		}()
+		for i := range tasks {
+			<-done[i]
+			os.Stdout.Write(outputs[i].Bytes())
+			if results[i] != nil {
+				errs.Errors = append(errs.Errors, results[i])
+			}
+		}
+	}
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
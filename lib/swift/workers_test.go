@@ -0,0 +1,100 @@
+package swift_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	swift "github.com/osallou/herodote-file/lib/swift"
+)
+
+// captureStdout returns what fn writes to stdout
+func captureStdout(fn func()) string {
+	r, w, _ := os.Pipe()
+	stdout := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = stdout
+	w.Close()
+	content, _ := ioutil.ReadAll(r)
+	return string(content)
+}
+
+func TestSwiftRunObjects(t *testing.T) {
+	var tasks []swift.ObjectTask
+	for i := 0; i < 5; i++ {
+		i := i
+		tasks = append(tasks, func(out io.Writer) error {
+			fmt.Fprintf(out, "start %d\n", i)
+			// first tasks finish last
+			time.Sleep(time.Duration(5-i) * 5 * time.Millisecond)
+			fmt.Fprintf(out, "end %d\n", i)
+			if i%2 == 1 {
+				return fmt.Errorf("task %d failed", i)
+			}
+			return nil
+		})
+	}
+	var err error
+	output := captureStdout(func() { err = swift.RunObjects(3, tasks) })
+	expected := "start 0\nend 0\nstart 1\nend 1\nstart 2\nend 2\nstart 3\nend 3\nstart 4\nend 4\n"
+	if output != expected {
+		t.Errorf("output is not ordered: %s", output)
+	}
+	objErr, ok := err.(*swift.ObjectsError)
+	if !ok || objErr.Total != 5 || len(objErr.Errors) != 2 || !strings.Contains(err.Error(), "task 3 failed") {
+		t.Errorf("wrong aggregated error: %v", err)
+	}
+	if err := swift.RunObjects(2, tasks[:1]); err != nil {
+		t.Errorf("no error expected: %s", err)
+	}
+}
+
+func TestSwiftDownloadWithPrefixThreads(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/project" {
+			res.WriteHeader(200)
+			if req.URL.Query().Get("marker") != "" {
+				res.Write([]byte(`[]`))
+				return
+			}
+			res.Write([]byte(`[{"name": "data/a"}, {"name": "data/b"}, {"name": "data/missing"}, {"name": "data/c"}]`))
+			return
+		}
+		if req.URL.Path == "/project/data/missing" {
+			res.WriteHeader(404)
+			return
+		}
+		res.WriteHeader(200)
+		res.Write([]byte(req.URL.Path))
+	}))
+	defer func() { testServer.Close() }()
+	dir, _ := ioutil.TempDir("", "hero")
+	defer os.RemoveAll(dir)
+
+	options := swift.Options{Bucket: "project", Prefix: "data/", ObjectName: dir, ObjectThreads: 3}
+	var err error
+	output := captureStdout(func() { err = swift.DownloadWithPrefix("123", testServer.URL, options) })
+	if err == nil || !strings.Contains(err.Error(), "1 of 4 objects failed") {
+		t.Errorf("missing object error not reported: %v", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if content, _ := ioutil.ReadFile(filepath.Join(dir, "data", name)); string(content) != "/project/data/"+name {
+			t.Errorf("file %s not downloaded: %s", name, content)
+		}
+	}
+	if !strings.HasPrefix(output, "Download data/a") || strings.Index(output, "data/b") > strings.Index(output, "data/c") {
+		t.Errorf("wrong output: %s", output)
+	}
+	// failure is reported with messages of its object
+	if !strings.Contains(output, "Download data/missing => "+filepath.Join(dir, "data/missing")+"\nError: 404") {
+		t.Errorf("failure not reported with its object: %s", output)
+	}
+}